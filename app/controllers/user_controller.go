@@ -19,7 +19,11 @@ type UserController struct {
 func (uc *UserController) Index(c *fiber.Ctx) error {
 	var users []models.User
 
-	qb := database.NewQueryBuilder(uc.DB.Connection())
+	db, err := uc.DB.Connection()
+	if err != nil {
+		return err
+	}
+	qb := database.NewQueryBuilder(db)
 	page := c.QueryInt("page", 1)
 	perPage := c.QueryInt("per_page", 15)
 
@@ -59,7 +63,11 @@ func (uc *UserController) Store(c *fiber.Ctx) error {
 		Status:   "active",
 	}
 
-	model := database.NewModel(uc.DB.Connection())
+	db, err := uc.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Create(&user); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to create user"})
 	}
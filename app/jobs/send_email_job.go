@@ -8,9 +8,9 @@ import (
 // SendEmailJob handles email sending
 type SendEmailJob struct {
 	queue.BaseJob
-	Email   string
-	Subject string
-	Body    string
+	Email   string `json:"email"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
 }
 
 func (j *SendEmailJob) Handle() error {
@@ -4,6 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+
+	"github.com/test/myapp/framework"
 )
 
 func RunCommands() error {
@@ -34,6 +37,23 @@ func RunCommands() error {
 	return nil
 }
 
+// IsAppCommand reports whether a subcommand runs against the booted
+// application rather than on its own
+func IsAppCommand(name string) bool {
+	return strings.HasPrefix(name, "schedule:") || strings.HasPrefix(name, "queue:")
+}
+
+// RunAppCommand runs a subcommand that needs the booted application
+func RunAppCommand(app *framework.Golara, name string) error {
+	switch {
+	case strings.HasPrefix(name, "schedule:"):
+		return RunScheduleCommand(app.Schedule, name)
+	case strings.HasPrefix(name, "queue:"):
+		return RunQueueCommand(app.Queue, name)
+	}
+	return fmt.Errorf("unknown command '%s'", name)
+}
+
 func ShowHelp() {
 	fmt.Println(`
 🔥 Golara Framework CLI
@@ -52,6 +72,10 @@ For other commands, use: go run main.go -subcommand <command>
   make:job <name>            Generate a new job
   make:view <name>           Generate a new view template
   make:migration <name>      Generate a new migration
+  schedule:run               Run the scheduled tasks that are due now
+  schedule:work              Run the scheduler in the foreground
+  schedule:list              List the scheduled tasks
+  queue:status               Show the size and failed jobs of each queue
 
 Usage:
   ./golara -subcommand init
@@ -199,15 +199,18 @@ func createMainFile(config *ProjectConfig) error {
 	mainTemplate := `package main
 
 import (
+	"context"
 	"{{.ModuleName}}/app/jobs"
 	"{{.ModuleName}}/cmd"
 	"{{.ModuleName}}/config"
 	"{{.ModuleName}}/framework"
-	"{{.ModuleName}}/framework/database"
 	"{{.ModuleName}}/framework/queue"
 	"{{.ModuleName}}/routes"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -218,53 +221,47 @@ func main() {
 
 	// Handle CLI commands
 	subCmd := "-subcommand"
-	if len(os.Args) > 1 && os.Args[1] == subCmd {
-		// Connect to database only for migration commands
-		if len(os.Args) > 2 && (os.Args[2] == "migrate" || os.Args[2] == "migrate:rollback" || os.Args[2] == "migrate:status") {
-			if err := config.ConnectDB(); err != nil {
-				log.Fatalf("Failed to connect to database: %v", err)
-			}
-		}
+	appCmd := len(os.Args) > 2 && os.Args[1] == subCmd && cmd.IsAppCommand(os.Args[2])
+	if len(os.Args) > 1 && os.Args[1] == subCmd && !appCmd {
 		if err := cmd.RunCommands(); err != nil {
 			log.Fatal(err)
 		}
 		return
 	}
 
-	// Connect to database for server mode
-	if err := config.ConnectDB(); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-
 	// Create Golara application
-	app := framework.New(framework.Config{
+	app, err := framework.New(framework.Config{
 		AppName:     config.Denv("APP_NAME"),
 		Version:     "1.0.0",
 		Environment: config.Denv("APP_ENV"),
-		RedisAddr:   config.Denv("REDIS_HOST") + ":" + config.Denv("REDIS_PORT"),
-		RedisPass:   config.Denv("REDIS_PASSWORD"),
-		RedisDB:     0,
 	})
+	if err != nil {
+		log.Fatalf("Failed to start application: %v", err)
+	}
 
-	// Connect to database
-	err := app.ConnectDatabase("mysql", database.DatabaseConfig{
-		Driver:   config.Denv("DB_CONNECTION"),
-		Host:     config.Denv("DB_HOST"),
-		Port:     config.Denv("DB_PORT"),
-		Database: config.Denv("DB_DATABASE"),
-		Username: config.Denv("DB_USERNAME"),
-		Password: config.Denv("DB_PASSWORD"),
-		Charset:  "utf8mb4",
-	})
+	// Connect the databases configured in .denv.yaml, retrying while they
+	// are still starting up
+	dbCtx, dbCancel := context.WithTimeout(context.Background(), config.GetEnvDuration("DB_CONNECT_TIMEOUT", time.Minute))
+	err = app.ConnectDatabases(dbCtx)
+	dbCancel()
 	if err != nil {
-		log.Printf("Warning: Database connection failed: %v", err)
+		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
 	// Register job handlers
-	app.Queue.RegisterJob("send_email", func() queue.Job {
-		return &jobs.SendEmailJob{}
-	})
+	queue.RegisterTypedJob[jobs.SendEmailJob](app.Queue, "send_email")
 
+	// Register scheduled tasks
+	routes.RegisterSchedule(app)
+	
+	// Scheduler and queue commands run against the fully configured application
+	if appCmd {
+		if err := cmd.RunAppCommand(app, os.Args[2]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	
 	// Start queue workers
 	app.StartQueue("default", 3)
 
@@ -280,7 +277,22 @@ func main() {
 	log.Printf("🔥 %s starting on port %s", config.Denv("APP_NAME"), port)
 	log.Printf("📚 API Documentation: http://localhost:%s/docs", port)
 	
-	app.Listen(":" + port)
+	go func() {
+		if err := app.Listen(":" + port); err != nil {
+			log.Printf("Server stopped: %v", err)
+		}
+	}()
+
+	// Wait for an interrupt, then drain workers and close connections
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown finished with errors: %v", err)
+	}
 }
 `
 
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/test/myapp/framework/queue"
+)
+
+// RunQueueCommand runs one of the queue:* subcommands
+func RunQueueCommand(qm *queue.QueueManager, name string) error {
+	switch name {
+	case "queue:status":
+		return showQueueStatus(qm)
+	}
+
+	return fmt.Errorf("unknown queue command '%s'", name)
+}
+
+func showQueueStatus(qm *queue.QueueManager) error {
+	statuses, err := qm.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUEUE\tPENDING\tDELAYED\tRESERVED\tFAILED")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", status.Name, status.Pending, status.Delayed, status.Reserved, status.Failed)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/test/myapp/framework/schedule"
+)
+
+// RunScheduleCommand runs one of the schedule:* subcommands
+func RunScheduleCommand(s *schedule.Schedule, name string) error {
+	switch name {
+	case "schedule:run":
+		// Meant to be called every minute by the system cron
+		return s.RunDue(time.Now())
+
+	case "schedule:work":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return s.Run(ctx)
+
+	case "schedule:list":
+		listSchedule(s)
+		return nil
+	}
+
+	return fmt.Errorf("unknown schedule command '%s'", name)
+}
+
+func listSchedule(s *schedule.Schedule) {
+	events := s.Events()
+	if len(events) == 0 {
+		fmt.Println("No scheduled tasks have been defined.")
+		return
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EXPRESSION\tTASK\tNEXT DUE\tDESCRIPTION")
+	for _, event := range events {
+		var next string
+		if err := event.Err(); err != nil {
+			next = "invalid: " + err.Error()
+		} else {
+			next = event.NextRun(now).Format("2006-01-02 15:04 MST")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", event.Expression(), event.GetName(), next, event.GetDescription())
+	}
+	w.Flush()
+}
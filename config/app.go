@@ -2,9 +2,11 @@ package config
 
 import (
 	"github.com/test/myapp/internal/constants"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // AppConfig holds application configuration
@@ -23,6 +25,8 @@ type DatabaseConfig struct {
 	Connections map[string]DatabaseConnection
 }
 
+// DatabaseConnection configures one database connection. Options are
+// extra DSN parameters; zero pool settings use the framework defaults.
 type DatabaseConnection struct {
 	Driver   string
 	Host     string
@@ -31,7 +35,42 @@ type DatabaseConnection struct {
 	Username string
 	Password string
 	Charset  string
+	Timezone string
 	Options  map[string]string
+	
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+	
+	MaxIdleConns    int
+	MaxOpenConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	
+	LogLevel      string
+	SlowThreshold time.Duration
+	LogFile       string
+	
+	PrepareStmt            bool
+	SkipDefaultTransaction bool
+	
+	Read   []string
+	Write  string
+	Sticky bool
+}
+
+// RedisConfig holds named Redis connections shared by cache stores and
+// queue connections
+type RedisConfig struct {
+	Connections map[string]RedisConnection
+}
+
+type RedisConnection struct {
+	Host     string
+	Port     string
+	Password string
+	Database int
 }
 
 // CacheConfig holds cache configuration
@@ -40,13 +79,20 @@ type CacheConfig struct {
 	Stores  map[string]CacheStore
 }
 
+// CacheStore configures one cache store. Redis-backed stores use the
+// named Connection, or Host, Port, Password and Database when it is empty.
 type CacheStore struct {
-	Driver   string
-	Host     string
-	Port     string
-	Password string
-	Database int
-	Prefix   string
+	Driver     string
+	Connection string
+	Host       string
+	Port       string
+	Password   string
+	Database   int
+	Prefix     string
+	
+	// Limits for memory stores and the local tier of tiered stores
+	MaxEntries int
+	MaxBytes   int64
 }
 
 // QueueConfig holds queue configuration
@@ -55,13 +101,18 @@ type QueueConfig struct {
 	Connections map[string]QueueConnection
 }
 
+// QueueConnection configures one queue connection. Redis connections use
+// the named Connection, or Host, Port, Password and Database when it is
+// empty. Database connections use the named database connection, or the
+// default one when it is empty.
 type QueueConnection struct {
-	Driver   string
-	Host     string
-	Port     string
-	Password string
-	Database int
-	Queue    string
+	Driver     string
+	Connection string
+	Host       string
+	Port       string
+	Password   string
+	Database   int
+	Queue      string
 }
 
 // LoadAppConfig loads application configuration
@@ -76,64 +127,153 @@ func LoadAppConfig() *AppConfig {
 	}
 }
 
-// LoadDatabaseConfig loads database configuration
+// LoadDatabaseConfig loads database configuration. The connection is named
+// after DB_CONNECTION, the driver. Outside development only warnings and
+// slow queries are logged, to storage/logs/gorm.log.
 func LoadDatabaseConfig() *DatabaseConfig {
+	driver := GetEnv("DB_CONNECTION", "mysql")
+	
+	logLevel, logFile := "info", ""
+	if !IsDevelopment() {
+		logLevel, logFile = "warn", "storage/logs/gorm.log"
+	}
+	
+	conn := DatabaseConnection{
+		Driver:   driver,
+		Host:     GetEnv("DB_HOST", "localhost"),
+		Port:     GetEnv("DB_PORT", defaultDatabasePort(driver)),
+		Database: GetEnv("DB_DATABASE", "golara"),
+		Username: GetEnv("DB_USERNAME", "root"),
+		Password: GetEnv("DB_PASSWORD", ""),
+		Charset:  GetEnv("DB_CHARSET", "utf8mb4"),
+		Timezone: GetEnv("DB_TIMEZONE", ""),
+		Options:  GetEnvMap("DB_OPTIONS", nil),
+		
+		SSLMode:     GetEnv("DB_SSLMODE", ""),
+		SSLRootCert: GetEnv("DB_SSL_ROOT_CERT", ""),
+		SSLCert:     GetEnv("DB_SSL_CERT", ""),
+		SSLKey:      GetEnv("DB_SSL_KEY", ""),
+		
+		MaxIdleConns:    GetEnvInt("DB_MAX_IDLE_CONNS", 10),
+		MaxOpenConns:    GetEnvInt("DB_MAX_OPEN_CONNS", 100),
+		ConnMaxLifetime: GetEnvDuration("DB_CONN_MAX_LIFETIME", time.Hour),
+		ConnMaxIdleTime: GetEnvDuration("DB_CONN_MAX_IDLE_TIME", 0),
+		
+		LogLevel:      GetEnv("DB_LOG_LEVEL", logLevel),
+		SlowThreshold: GetEnvDuration("DB_SLOW_THRESHOLD", 0),
+		LogFile:       GetEnv("DB_LOG_FILE", logFile),
+		
+		PrepareStmt:            GetEnvBool("DB_PREPARE_STMT", true),
+		SkipDefaultTransaction: GetEnvBool("DB_SKIP_DEFAULT_TRANSACTION", true),
+		
+		Read:   GetEnvSlice("DB_READ_HOSTS", nil, ","),
+		Write:  GetEnv("DB_WRITE_HOST", ""),
+		Sticky: GetEnvBool("DB_STICKY", false),
+	}
+	if driver == "mysql" && conn.Options["collation"] == "" {
+		if conn.Options == nil {
+			conn.Options = make(map[string]string)
+		}
+		conn.Options["collation"] = "utf8mb4_unicode_ci"
+	}
+	
 	return &DatabaseConfig{
-		Default: GetEnv("DB_CONNECTION", "mysql"),
+		Default: driver,
 		Connections: map[string]DatabaseConnection{
-			"mysql": {
-				Driver:   "mysql",
-				Host:     GetEnv("DB_HOST", "localhost"),
-				Port:     GetEnv("DB_PORT", "3306"),
-				Database: GetEnv("DB_DATABASE", "golara"),
-				Username: GetEnv("DB_USERNAME", "root"),
-				Password: GetEnv("DB_PASSWORD", ""),
-				Charset:  GetEnv("DB_CHARSET", "utf8mb4"),
-				Options: map[string]string{
-					"parseTime": "True",
-					"loc":       "Local",
-				},
-			},
+			driver: conn,
 		},
 	}
 }
 
-// LoadCacheConfig loads cache configuration
-func LoadCacheConfig() *CacheConfig {
-	return &CacheConfig{
-		Default: GetEnv("CACHE_DRIVER", constants.CacheDriverMemory),
-		Stores: map[string]CacheStore{
-			constants.CacheDriverRedis: {
-				Driver:   constants.CacheDriverRedis,
+func defaultDatabasePort(driver string) string {
+	switch driver {
+	case "postgres", "postgresql":
+		return "5432"
+	case "sqlite":
+		return ""
+	default:
+		return "3306"
+	}
+}
+
+// LoadRedisConfig loads the Redis connections. The "default" connection
+// comes from REDIS_HOST, REDIS_PORT, REDIS_PASSWORD and REDIS_DB.
+func LoadRedisConfig() *RedisConfig {
+	return &RedisConfig{
+		Connections: map[string]RedisConnection{
+			"default": {
 				Host:     GetEnv("REDIS_HOST", "localhost"),
 				Port:     GetEnv("REDIS_PORT", "6379"),
 				Password: GetEnv("REDIS_PASSWORD", ""),
 				Database: GetEnvInt("REDIS_DB", 0),
-				Prefix:   GetEnv("CACHE_PREFIX", constants.DefaultCachePrefix),
 			},
+		},
+	}
+}
+
+// LoadCacheConfig loads cache configuration. The memory store is always
+// configured; Redis-backed stores only when CACHE_DRIVER selects them, so
+// an application without Redis does not need it running.
+func LoadCacheConfig() *CacheConfig {
+	prefix := GetEnv("CACHE_PREFIX", constants.DefaultCachePrefix)
+	cfg := &CacheConfig{
+		Default: GetEnv("CACHE_DRIVER", constants.CacheDriverMemory),
+		Stores: map[string]CacheStore{
 			constants.CacheDriverMemory: {
-				Driver: constants.CacheDriverMemory,
-				Prefix: GetEnv("CACHE_PREFIX", constants.DefaultCachePrefix),
+				Driver:     constants.CacheDriverMemory,
+				Prefix:     prefix,
+				MaxEntries: GetEnvInt("CACHE_MAX_ENTRIES", 0),
 			},
 		},
 	}
+	
+	switch cfg.Default {
+	case constants.CacheDriverRedis, constants.CacheDriverTiered:
+		cfg.Stores[cfg.Default] = CacheStore{
+			Driver:     cfg.Default,
+			Connection: GetEnv("CACHE_REDIS_CONNECTION", "default"),
+			Prefix:     prefix,
+			MaxEntries: GetEnvInt("CACHE_MAX_ENTRIES", 10000),
+		}
+	}
+	return cfg
 }
 
-// LoadQueueConfig loads queue configuration
+// LoadQueueConfig loads queue configuration. The memory connection is
+// always configured; the Redis, database and sync connections only when
+// QUEUE_CONNECTION selects them.
 func LoadQueueConfig() *QueueConfig {
-	return &QueueConfig{
+	queueName := GetEnv("QUEUE_NAME", constants.DefaultQueueName)
+	cfg := &QueueConfig{
 		Default: GetEnv("QUEUE_CONNECTION", constants.QueueDriverMemory),
 		Connections: map[string]QueueConnection{
-			constants.QueueDriverRedis: {
-				Driver:   constants.QueueDriverRedis,
-				Host:     GetEnv("REDIS_HOST", "localhost"),
-				Port:     GetEnv("REDIS_PORT", "6379"),
-				Password: GetEnv("REDIS_PASSWORD", ""),
-				Database: GetEnvInt("REDIS_DB", 0),
-				Queue:    GetEnv("QUEUE_NAME", constants.DefaultQueueName),
+			constants.QueueDriverMemory: {
+				Driver: constants.QueueDriverMemory,
+				Queue:  queueName,
 			},
 		},
 	}
+	
+	switch cfg.Default {
+	case constants.QueueDriverRedis:
+		cfg.Connections[constants.QueueDriverRedis] = QueueConnection{
+			Driver:     constants.QueueDriverRedis,
+			Connection: GetEnv("QUEUE_REDIS_CONNECTION", "default"),
+			Queue:      queueName,
+		}
+	case constants.QueueDriverDatabase:
+		cfg.Connections[constants.QueueDriverDatabase] = QueueConnection{
+			Driver:     constants.QueueDriverDatabase,
+			Connection: GetEnv("QUEUE_DB_CONNECTION", ""),
+			Queue:      queueName,
+		}
+	case constants.QueueDriverSync:
+		cfg.Connections[constants.QueueDriverSync] = QueueConnection{
+			Driver: constants.QueueDriverSync,
+			Queue:  queueName,
+		}
+	}
+	return cfg
 }
 
 // Helper functions for environment variables
@@ -172,6 +312,33 @@ func GetEnvSlice(key string, defaultValue []string, separator string) []string {
 	return defaultValue
 }
 
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := GetEnv(key, ""); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// GetEnvMap parses a query string such as "timeout=5s&tls=true"
+func GetEnvMap(key string, defaultValue map[string]string) map[string]string {
+	value := GetEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	values, err := url.ParseQuery(value)
+	if err != nil {
+		return defaultValue
+	}
+	
+	parsed := make(map[string]string, len(values))
+	for k := range values {
+		parsed[k] = values.Get(k)
+	}
+	return parsed
+}
+
 // IsProduction checks if app is in production
 func IsProduction() bool {
 	return GetEnv("APP_ENV", constants.EnvDevelopment) == constants.EnvProduction
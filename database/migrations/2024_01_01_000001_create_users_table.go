@@ -1,6 +1,8 @@
 package migrations
 
 import (
+	"github.com/test/myapp/framework/database/schema"
+
 	"gorm.io/gorm"
 )
 
@@ -9,24 +11,18 @@ func CreateUsersTableMigration() (string, func(*gorm.DB) error, func(*gorm.DB) e
 	return "2024_01_01_000001_create_users_table",
 		// Up
 		func(db *gorm.DB) error {
-			return db.Exec(`
-				CREATE TABLE users (
-					id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-					name VARCHAR(100) NOT NULL,
-					email VARCHAR(100) NOT NULL UNIQUE,
-					password VARCHAR(255) NOT NULL,
-					status VARCHAR(20) DEFAULT 'active',
-					created_at TIMESTAMP NULL,
-					updated_at TIMESTAMP NULL,
-					deleted_at TIMESTAMP NULL,
-					INDEX idx_users_deleted_at (deleted_at),
-					INDEX idx_users_email (email),
-					INDEX idx_users_status (status)
-				)
-			`).Error
+			return schema.New(db).Create("users", func(t *schema.Blueprint) {
+				t.ID()
+				t.String("name", 100)
+				t.String("email", 100).Unique()
+				t.String("password", 255)
+				t.String("status", 20).Nullable().Default("active").Index()
+				t.Timestamps()
+				t.SoftDeletes()
+			})
 		},
 		// Down
 		func(db *gorm.DB) error {
-			return db.Exec("DROP TABLE IF EXISTS users").Error
+			return schema.New(db).DropIfExists("users")
 		}
-}
\ No newline at end of file
+}
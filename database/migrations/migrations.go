@@ -2,6 +2,7 @@ package migrations
 
 import (
 	"github.com/test/myapp/framework/database"
+	"github.com/test/myapp/framework/queue"
 
 	"gorm.io/gorm"
 )
@@ -12,6 +13,10 @@ func RegisterMigrations(migrator *database.Migrator) {
 	name, up, down := CreateUsersTableMigration()
 	migrator.Add(name, up, down)
 
+	// Jobs table for the database queue driver
+	name, up, down = queue.CreateJobsTableMigration()
+	migrator.Add(name, up, down)
+
 	// Add more migrations here as you create them
 	// name2, up2, down2 := CreateProductsTableMigration()
 	// migrator.Add(name2, up2, down2)
@@ -1,10 +1,14 @@
 package examples
 
 import (
+	"github.com/test/myapp/config"
 	"github.com/test/myapp/framework"
 	"github.com/test/myapp/framework/database"
+	"github.com/test/myapp/framework/queue"
 	"github.com/test/myapp/internal/constants"
+	"github.com/test/myapp/routes"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
@@ -20,10 +24,13 @@ type BlogPost struct {
 }
 
 func TestBlogAPI(t *testing.T) {
-	app := framework.New(framework.Config{
+	app, err := framework.New(framework.Config{
 		AppName:     "Blog Test",
 		Environment: constants.EnvTesting,
 	})
+	if err != nil {
+		t.Fatalf("framework.New: %v", err)
+	}
 
 	// Mock blog endpoints
 	app.App.Get("/posts", func(c *fiber.Ctx) error {
@@ -68,3 +75,89 @@ func TestQueryBuilder(t *testing.T) {
 	// Note: Actual database operations require a valid DB connection
 	t.Log("QueryBuilder structure test passed - actual DB operations require connection")
 }
+
+func TestNewBuildsConfiguredStoresAndFailsOnUnreachableRedis(t *testing.T) {
+	app, err := framework.New(framework.Config{
+		Cache: &config.CacheConfig{
+			Default: "local",
+			Stores: map[string]config.CacheStore{
+				"local": {Driver: constants.CacheDriverMemory, Prefix: "test", MaxEntries: 10},
+			},
+		},
+		Queue: &config.QueueConfig{
+			Default: "memory",
+			Connections: map[string]config.QueueConnection{
+				"memory": {Driver: constants.QueueDriverMemory, Queue: "jobs"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("framework.New: %v", err)
+	}
+	if names := app.Cache.Names(); len(names) != 1 || names[0] != "local" {
+		t.Errorf("Expected only the configured store, got %v", names)
+	}
+	if err := app.Queue.Dispatch(&queue.BaseJob{Name: "noop"}); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if size, _ := app.Queue.Queue("jobs").Size(); size != 1 {
+		t.Errorf("Expected the job on the configured queue name, got size %d", size)
+	}
+
+	// Nothing listens on port 1
+	_, err = framework.New(framework.Config{
+		Cache: &config.CacheConfig{
+			Default: "redis",
+			Stores: map[string]config.CacheStore{
+				"redis": {Driver: constants.CacheDriverRedis, Connection: "sessions", Prefix: "test"},
+			},
+		},
+		Redis: &config.RedisConfig{
+			Connections: map[string]config.RedisConnection{
+				"sessions": {Host: "127.0.0.1", Port: "1"},
+			},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "sessions") {
+		t.Errorf("Expected an error naming the unreachable connection, got %v", err)
+	}
+}
+
+func TestMonitoringRoutesAreOptInAndRequireAPIKey(t *testing.T) {
+	newApp := func() *framework.Golara {
+		app, err := framework.New(framework.Config{AppName: "Monitoring Test", Environment: constants.EnvTesting})
+		if err != nil {
+			t.Fatalf("framework.New: %v", err)
+		}
+		routes.RegisterAPIRoutes(app)
+		return app
+	}
+	status := func(app *framework.Golara, key string) int {
+		req := httptest.NewRequest("GET", "/api/queue/status", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := app.App.Test(req)
+		if err != nil {
+			t.Fatalf("GET /api/queue/status failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	t.Setenv("MONITORING_API_KEYS", "")
+	if code := status(newApp(), ""); code != 404 {
+		t.Errorf("Expected the route to be disabled without keys, got %d", code)
+	}
+
+	t.Setenv("MONITORING_API_KEYS", "ops-key, other-key")
+	app := newApp()
+	if code := status(app, ""); code != 401 {
+		t.Errorf("Expected 401 without a key, got %d", code)
+	}
+	if code := status(app, "wrong"); code != 401 {
+		t.Errorf("Expected 401 for a wrong key, got %d", code)
+	}
+	if code := status(app, "other-key"); code != 200 {
+		t.Errorf("Expected 200 with a key, got %d", code)
+	}
+}
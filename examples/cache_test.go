@@ -0,0 +1,489 @@
+package examples
+
+import (
+	"bytes"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/test/myapp/framework/cache"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheTagsFlushOnlyTaggedKeys(t *testing.T) {
+	store := cache.NewMemoryCache("test")
+
+	store.Tags("users", "team:5").Set("user:1", "jane", time.Minute)
+	store.Tags("users").Set("user:2", "john", time.Minute)
+	store.Tags("team:5").Set("team:5:name", "core", time.Minute)
+	store.Set("settings", "dark", time.Minute)
+
+	if err := store.Tags("users").Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	var value string
+	for _, key := range []string{"user:1", "user:2"} {
+		if err := store.Get(key, &value); err != cache.ErrCacheMiss {
+			t.Errorf("Expected %s to be flushed, got %v", key, err)
+		}
+	}
+	for _, key := range []string{"team:5:name", "settings"} {
+		if err := store.Get(key, &value); err != nil {
+			t.Errorf("Expected %s to survive the flush, got %v", key, err)
+		}
+	}
+}
+
+func TestRememberCoalescesConcurrentMisses(t *testing.T) {
+	store := cache.NewMemoryCache("test")
+
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var count int
+			err := store.Remember("users:count", time.Minute, func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(50 * time.Millisecond)
+				return 42, nil
+			}, &count)
+			if err != nil || count != 42 {
+				t.Errorf("Remember returned %d, %v", count, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected the callback to run once, ran %d times", calls)
+	}
+}
+
+func TestFlexibleServesStaleWhileRefreshing(t *testing.T) {
+	store := cache.NewMemoryCache("test")
+
+	var version int32
+	load := func() (interface{}, error) {
+		return atomic.AddInt32(&version, 1), nil
+	}
+
+	var value int
+	store.Flexible("stats", 20*time.Millisecond, time.Minute, load, &value)
+	if value != 1 {
+		t.Fatalf("Expected first load to return 1, got %d", value)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	store.Flexible("stats", 20*time.Millisecond, time.Minute, load, &value)
+	if value != 1 {
+		t.Errorf("Expected the stale value while refreshing, got %d", value)
+	}
+
+	waitFor(t, time.Second, func() bool {
+		store.Flexible("stats", 20*time.Millisecond, time.Minute, load, &value)
+		return value == 2
+	})
+}
+
+func TestCacheLockOwnership(t *testing.T) {
+	store := cache.NewMemoryCache("test")
+
+	lock := store.Lock("reports", time.Minute)
+	if acquired, err := lock.Get(); err != nil || !acquired {
+		t.Fatalf("Expected to acquire the lock, got %v, %v", acquired, err)
+	}
+
+	other := store.Lock("reports", time.Minute)
+	if err := other.Block(150 * time.Millisecond); err != cache.ErrLockTimeout {
+		t.Errorf("Expected ErrLockTimeout, got %v", err)
+	}
+	if released, _ := other.Release(); released {
+		t.Error("A lock must not be released by another owner")
+	}
+
+	restored := store.RestoreLock("reports", lock.Owner())
+	if released, _ := restored.Release(); !released {
+		t.Error("Expected the restored lock to release")
+	}
+	if acquired, _ := other.Get(); !acquired {
+		t.Error("Expected the lock to be free after release")
+	}
+}
+
+func TestCacheAtomicPrimitives(t *testing.T) {
+	store := cache.NewMemoryCache("test")
+
+	store.Increment("hits", 5)
+	if n, _ := store.Decrement("hits", 2); n != 3 {
+		t.Errorf("Expected 3 after decrement, got %d", n)
+	}
+
+	if added, _ := store.Add("token", "a", time.Minute); !added {
+		t.Error("Expected Add to store a new key")
+	}
+	if added, _ := store.Add("token", "b", time.Minute); added {
+		t.Error("Expected Add to keep the existing key")
+	}
+
+	var token string
+	if err := store.Pull("token", &token); err != nil || token != "a" {
+		t.Errorf("Pull returned %q, %v", token, err)
+	}
+	if err := store.Get("token", &token); err != cache.ErrCacheMiss {
+		t.Errorf("Expected Pull to delete the key, got %v", err)
+	}
+
+	store.Forever("config", "v1")
+	if err := store.Get("config", &token); err != nil || token != "v1" {
+		t.Errorf("Forever value not readable: %q, %v", token, err)
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	store := cache.NewMemoryCacheWithConfig("test", cache.MemoryCacheConfig{MaxEntries: 2})
+	defer store.Close()
+
+	store.Set("a", 1, time.Minute)
+	store.Set("b", 2, time.Minute)
+
+	var value int
+	store.Get("a", &value) // a is now more recently used than b
+	store.Set("c", 3, time.Minute)
+
+	if err := store.Get("b", &value); err != cache.ErrCacheMiss {
+		t.Errorf("Expected b to be evicted, got %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if err := store.Get(key, &value); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", key, err)
+		}
+	}
+
+	stats := store.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 || stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheSerializersKeepTypesAndReadOldValues(t *testing.T) {
+	store := cache.NewMemoryCache("test")
+	defer store.Close()
+
+	store.Set("legacy", map[string]string{"name": "jane"}, time.Minute)
+
+	type session struct {
+		UserID  int64
+		Expires time.Time
+		Notes   string
+	}
+	zone := time.FixedZone("CEST", 2*60*60)
+	want := session{
+		UserID:  1<<53 + 1,
+		Expires: time.Date(2024, 6, 1, 12, 0, 0, 0, zone),
+		Notes:   strings.Repeat("remember me ", 200),
+	}
+
+	for _, serializer := range []cache.Serializer{cache.GobSerializer{}, cache.MsgpackSerializer{}} {
+		if err := store.SetSerializer(serializer); err != nil {
+			t.Fatalf("SetSerializer with format %q failed: %v", serializer.Format(), err)
+		}
+		store.SetCompression(1024)
+
+		if err := store.Set("session", want, time.Minute); err != nil {
+			t.Fatalf("Set with format %q failed: %v", serializer.Format(), err)
+		}
+		var got session
+		if err := store.Get("session", &got); err != nil {
+			t.Fatalf("Get with format %q failed: %v", serializer.Format(), err)
+		}
+		if got.UserID != want.UserID || !got.Expires.Equal(want.Expires) || got.Notes != want.Notes {
+			t.Errorf("Format %q returned %+v", serializer.Format(), got)
+		}
+		// Gob keeps the zone; msgpack timestamps only keep the instant
+		if _, offset := got.Expires.Zone(); serializer.Format() == cache.FormatGob && offset != 2*60*60 {
+			t.Errorf("Expected gob to keep the zone offset, got %d", offset)
+		}
+
+		// Integers stay plain so they can still be incremented
+		store.Set("visits", 41, time.Minute)
+		if visits, err := store.Increment("visits", 1); err != nil || visits != 42 {
+			t.Errorf("Increment with format %q returned %d, %v", serializer.Format(), visits, err)
+		}
+	}
+
+	if stats := store.Stats(); stats.Bytes > 1024 {
+		t.Errorf("Expected large values to be compressed, cache holds %d bytes", stats.Bytes)
+	}
+
+	var legacy map[string]string
+	if err := store.Get("legacy", &legacy); err != nil || legacy["name"] != "jane" {
+		t.Errorf("Expected the JSON value to stay readable, got %v, %v", legacy, err)
+	}
+}
+
+// newTieredCaches returns two instances of a tiered cache sharing Redis
+func newTieredCaches(t *testing.T, localTTL time.Duration) (*miniredis.Miniredis, *cache.TieredCache, *cache.TieredCache) {
+	server, client := newRedis(t)
+	caches := make([]*cache.TieredCache, 2)
+	for i := range caches {
+		tc := cache.NewTieredCache(cache.NewMemoryCache("local"), cache.NewRedisCacheWithClient(client, "app"), cache.TieredCacheConfig{LocalTTL: localTTL})
+		t.Cleanup(func() { tc.Close() })
+		caches[i] = tc
+	}
+	waitFor(t, time.Second, func() bool {
+		return server.PubSubNumSub("cache:invalidate")["cache:invalidate"] == len(caches)
+	})
+	return server, caches[0], caches[1]
+}
+
+func TestTieredCacheReadsThroughToRedis(t *testing.T) {
+	server, a, b := newTieredCaches(t, time.Minute)
+
+	var value string
+	if err := b.Get("greeting", &value); err != cache.ErrCacheMiss {
+		t.Fatalf("Expected a miss, got %q, %v", value, err)
+	}
+
+	// Written past the tiered caches, so no invalidation races the reads
+	store := cache.NewRedisCache(server.Addr(), "", 0, "app")
+	defer store.Close()
+	store.Set("greeting", "hello", time.Minute)
+	if err := b.Get("greeting", &value); err != nil || value != "hello" {
+		t.Fatalf("Expected hello from Redis, got %q, %v", value, err)
+	}
+	a.Set("motto", "ship it", time.Minute)
+
+	// Both instances now answer from their local tier
+	server.Del("app:greeting")
+	server.Del("app:motto")
+	if err := b.Get("greeting", &value); err != nil || value != "hello" {
+		t.Errorf("Expected b to hit its local copy, got %q, %v", value, err)
+	}
+	if err := a.Get("motto", &value); err != nil || value != "ship it" {
+		t.Errorf("Expected a to hit the copy it wrote, got %q, %v", value, err)
+	}
+}
+
+func TestTieredCacheInvalidatesOtherInstances(t *testing.T) {
+	_, a, b := newTieredCaches(t, time.Minute)
+
+	var value string
+	a.Set("greeting", "hello", time.Minute)
+	if err := b.Get("greeting", &value); err != nil || value != "hello" {
+		t.Fatalf("Expected hello, got %q, %v", value, err)
+	}
+
+	a.Set("greeting", "bye", time.Minute)
+	waitFor(t, time.Second, func() bool {
+		return b.Get("greeting", &value) == nil && value == "bye"
+	})
+
+	a.Delete("greeting")
+	waitFor(t, time.Second, func() bool {
+		return b.Get("greeting", &value) == cache.ErrCacheMiss
+	})
+}
+
+func TestTieredCacheKeepsLocalCopiesNoLongerThanRedis(t *testing.T) {
+	server, a, b := newTieredCaches(t, 200*time.Millisecond)
+
+	var value string
+	a.Set("token", "short", 50*time.Millisecond)
+	a.Forever("settings", "dark")
+	for _, key := range []string{"token", "settings"} {
+		if err := b.Get(key, &value); err != nil {
+			t.Fatalf("Get %s failed: %v", key, err)
+		}
+	}
+
+	// The token's copy expires with the Redis key, long before LocalTTL
+	time.Sleep(100 * time.Millisecond)
+	server.FastForward(100 * time.Millisecond)
+	if err := b.Get("token", &value); err != cache.ErrCacheMiss {
+		t.Errorf("Expected the token to expire with Redis, got %q, %v", value, err)
+	}
+	if err := b.Get("settings", &value); err != nil || value != "dark" {
+		t.Errorf("Expected settings to stay local, got %q, %v", value, err)
+	}
+
+	// Keys without a TTL are kept locally for LocalTTL
+	server.Del("app:settings")
+	time.Sleep(150 * time.Millisecond)
+	if err := b.Get("settings", &value); err != cache.ErrCacheMiss {
+		t.Errorf("Expected settings to leave the local tier after LocalTTL, got %q, %v", value, err)
+	}
+}
+
+func TestSetSerializerRefusesTakenFormats(t *testing.T) {
+	store := cache.NewMemoryCache("test")
+	defer store.Close()
+
+	if err := store.SetSerializer(cache.MsgpackSerializer{}); err != nil {
+		t.Fatalf("Expected a built-in serializer to be accepted, got %v", err)
+	}
+	if err := store.SetSerializer(jsonImpostor{}); !errors.Is(err, cache.ErrFormatTaken) {
+		t.Fatalf("Expected ErrFormatTaken, got %v", err)
+	}
+
+	// The store keeps the serializer it had
+	store.Set("user", map[string]string{"name": "jane"}, time.Minute)
+	var user map[string]string
+	if err := store.Get("user", &user); err != nil || user["name"] != "jane" {
+		t.Errorf("Expected the msgpack value back, got %v, %v", user, err)
+	}
+}
+
+// jsonImpostor claims the JSON format byte
+type jsonImpostor struct{ cache.GobSerializer }
+
+func (jsonImpostor) Format() byte { return cache.FormatJSON }
+
+// msgpackRoundTrip encodes value with MsgpackSerializer and decodes it into
+// a value of the same type
+func msgpackRoundTrip[T any](t *testing.T, value T) T {
+	t.Helper()
+	var s cache.MsgpackSerializer
+	data, err := s.Marshal(value)
+	if err != nil {
+		t.Fatalf("Marshal %v failed: %v", value, err)
+	}
+	var got T
+	if err := s.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal %v failed: %v", value, err)
+	}
+	return got
+}
+
+func TestMsgpackRoundTrips(t *testing.T) {
+	// Integers at the edges of each encoding width
+	for _, i := range []int64{
+		math.MinInt64, math.MinInt32 - 1, math.MinInt32, math.MinInt16 - 1, math.MinInt16,
+		math.MinInt8 - 1, math.MinInt8, -33, -32, -1, 0, 127, 128, 255, 256,
+		math.MaxUint16, math.MaxUint16 + 1, math.MaxUint32, math.MaxUint32 + 1, math.MaxInt64,
+	} {
+		if got := msgpackRoundTrip(t, i); got != i {
+			t.Errorf("int64 %d came back as %d", i, got)
+		}
+	}
+	for _, u := range []uint64{0, 127, 128, 255, 256, math.MaxUint16, math.MaxUint16 + 1, math.MaxUint32, math.MaxUint32 + 1, math.MaxUint64} {
+		if got := msgpackRoundTrip(t, u); got != u {
+			t.Errorf("uint64 %d came back as %d", u, got)
+		}
+	}
+	type widths struct {
+		I8  int8
+		I16 int16
+		I32 int32
+		U8  uint8
+		U16 uint16
+		U32 uint32
+	}
+	for _, w := range []widths{
+		{math.MinInt8, math.MinInt16, math.MinInt32, 0, 0, 0},
+		{math.MaxInt8, math.MaxInt16, math.MaxInt32, math.MaxUint8, math.MaxUint16, math.MaxUint32},
+	} {
+		if got := msgpackRoundTrip(t, w); got != w {
+			t.Errorf("%+v came back as %+v", w, got)
+		}
+	}
+	if got := msgpackRoundTrip[interface{}](t, uint64(math.MaxUint64)); got != uint64(math.MaxUint64) {
+		t.Errorf("MaxUint64 in an interface came back as %T %v", got, got)
+	}
+
+	// Times keep their instant to the nanosecond
+	zone := time.FixedZone("IST", 5*60*60+30*60)
+	for _, tm := range []time.Time{{}, time.Date(2024, 2, 29, 23, 59, 59, 999999999, zone), time.Unix(1<<40, 1).UTC()} {
+		if got := msgpackRoundTrip(t, tm); !got.Equal(tm) {
+			t.Errorf("time %v came back as %v", tm, got)
+		}
+	}
+
+	// Binary data of each length width
+	for _, n := range []int{0, 31, 255, 256, math.MaxUint16 + 1} {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		if got := msgpackRoundTrip(t, data); !bytes.Equal(got, data) {
+			t.Errorf("%d bytes came back as %d bytes", n, len(got))
+		}
+	}
+
+	// Nested maps decode to the types encoding/json would use
+	nested := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name":  "jane",
+			"roles": []interface{}{"admin", int64(7), nil, true, 1.5},
+		},
+		"empty": map[string]interface{}{},
+	}
+	if got := msgpackRoundTrip[interface{}](t, nested); !reflect.DeepEqual(got, interface{}(nested)) {
+		t.Errorf("nested maps came back as %#v", got)
+	}
+	if got := msgpackRoundTrip(t, map[int]string{-1: "a", 300: "b"}); !reflect.DeepEqual(got, map[int]string{-1: "a", 300: "b"}) {
+		t.Errorf("integer keyed map came back as %v", got)
+	}
+
+	// Nested structs, pointers and nil
+	type address struct {
+		City string `msgpack:"city"`
+	}
+	type account struct {
+		ID       uint64
+		Name     string `json:"name"`
+		Home     *address
+		Previous []address
+		Labels   map[string]string
+		Avatar   []byte
+		Deleted  *time.Time
+	}
+	want := account{
+		ID:       math.MaxUint64,
+		Name:     "jane",
+		Home:     &address{City: "Lisbon"},
+		Previous: []address{{City: "Porto"}, {}},
+		Labels:   map[string]string{"team": "core"},
+		Avatar:   []byte{0, 1, 2},
+	}
+	if got := msgpackRoundTrip(t, want); !reflect.DeepEqual(got, want) {
+		t.Errorf("struct came back as %+v", got)
+	}
+	if got := msgpackRoundTrip(t, &want); !reflect.DeepEqual(got, &want) {
+		t.Errorf("struct pointer came back as %+v", got)
+	}
+
+	var s cache.MsgpackSerializer
+	data, err := s.Marshal(nil)
+	if err != nil {
+		t.Fatalf("Marshal nil failed: %v", err)
+	}
+	name, labels := new(string), map[string]string{"team": "core"}
+	if err := s.Unmarshal(data, &name); err != nil || name != nil {
+		t.Errorf("Expected nil to clear a pointer, got %v, %v", name, err)
+	}
+	if err := s.Unmarshal(data, &labels); err != nil || labels != nil {
+		t.Errorf("Expected nil to clear a map, got %v, %v", labels, err)
+	}
+
+	// Malformed and truncated input is reported, not decoded
+	whole, _ := s.Marshal(want)
+	for name, data := range map[string][]byte{
+		"empty":      {},
+		"truncated":  whole[:len(whole)/2],
+		"reserved":   {0xc1},
+		"long str":   {0xdb, 0xff, 0xff, 0xff, 0xff, 'a'},
+		"wrong type": {0xa3, 'a', 'b', 'c'},
+	} {
+		var got account
+		if err := s.Unmarshal(data, &got); err == nil {
+			t.Errorf("Expected an error decoding %s input", name)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/test/myapp/config"
+	"github.com/test/myapp/database/migrations"
+	"github.com/test/myapp/framework"
+	"github.com/test/myapp/framework/database"
+	"github.com/test/myapp/framework/database/schema"
+	"github.com/test/myapp/framework/events"
+	"github.com/test/myapp/framework/queue"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Account struct {
+	ID      uint
+	Name    string
+	Balance int
+}
+
+func newSQLiteManager(t *testing.T) *database.DatabaseManager {
+	t.Helper()
+
+	dm := database.NewDatabaseManager()
+	err := dm.Connect("sqlite", database.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(t.TempDir(), "app.db"),
+	})
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(func() { dm.Close() })
+
+	if err := connection(t, dm).AutoMigrate(&Account{}); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+	return dm
+}
+
+// connection returns a connection that must be available
+func connection(t *testing.T, dm *database.DatabaseManager, name ...string) *gorm.DB {
+	t.Helper()
+
+	db, err := dm.Connection(name...)
+	if err != nil {
+		t.Fatalf("Connection failed: %v", err)
+	}
+	return db
+}
+
+func TestTransactionSavepointsAndAfterCommit(t *testing.T) {
+	dm := newSQLiteManager(t)
+	ctx := context.Background()
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+	ed := events.NewEventDispatcher()
+	ed.SetTransactions(database.Transactions{})
+
+	var fired []string
+	ed.ListenFunc("account.opened", func(event events.Event) error {
+		fired = append(fired, "event")
+		return nil
+	})
+	err := dm.Transaction(ctx, func(tx *gorm.DB) error {
+		txCtx := tx.Statement.Context
+		tx.Create(&Account{Name: "jane", Balance: 100})
+		database.AfterCommit(txCtx, func() { fired = append(fired, "jane") })
+		qm.DispatchAfterCommit(txCtx, &queue.BaseJob{Name: "welcome"})
+		ed.DispatchAfterCommit(txCtx, &events.BaseEvent{Name: "account.opened"})
+
+		// A failing nested transaction only rolls back its own work
+		nested := dm.Transaction(txCtx, func(tx *gorm.DB) error {
+			tx.Create(&Account{Name: "john"})
+			database.AfterCommit(tx.Statement.Context, func() { fired = append(fired, "john") })
+			return errors.New("card declined")
+		})
+		if nested == nil {
+			t.Error("Expected the nested transaction's error")
+		}
+
+		// Models given the context join the transaction and see its rows
+		count, err := database.NewModel(connection(t, dm)).WithContext(txCtx).Query().Model(&Account{}).Count()
+		if err != nil || count != 1 {
+			t.Errorf("Expected 1 account inside the transaction, got %d, %v", count, err)
+		}
+		count, err = database.NewQueryBuilder(connection(t, dm)).Model(&Account{}).Where("name", "=", "jane").WithContext(txCtx).Count()
+		if err != nil || count != 1 {
+			t.Errorf("Expected the builder to join the transaction and keep its conditions, got %d, %v", count, err)
+		}
+		if size, _ := qm.Queue().Size(); len(fired) != 0 || size != 0 {
+			t.Error("Expected hooks and dispatches to wait for the commit")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+
+	var names []string
+	connection(t, dm).Model(&Account{}).Order("id").Pluck("name", &names)
+	if len(names) != 1 || names[0] != "jane" {
+		t.Errorf("Expected only jane to be committed, got %v", names)
+	}
+	if strings.Join(fired, ",") != "jane,event" {
+		t.Errorf("Expected only the committed hook and event to fire, got %v", fired)
+	}
+	if size, _ := qm.Queue().Size(); size != 1 {
+		t.Errorf("Expected the job to be dispatched after commit, got %d queued", size)
+	}
+
+	// Errors and panics roll the whole transaction back
+	dm.Transaction(ctx, func(tx *gorm.DB) error {
+		tx.Create(&Account{Name: "ghost"})
+		database.AfterCommit(tx.Statement.Context, func() { fired = append(fired, "ghost") })
+		return errors.New("abort")
+	})
+	func() {
+		defer func() { recover() }()
+		dm.Transaction(ctx, func(tx *gorm.DB) error {
+			tx.Create(&Account{Name: "panic"})
+			panic("boom")
+		})
+	}()
+
+	var count int64
+	connection(t, dm).Model(&Account{}).Count(&count)
+	if count != 1 || len(fired) != 2 {
+		t.Errorf("Expected rolled back transactions to leave no rows or hooks, got %d rows and %v", count, fired)
+	}
+}
+
+func TestReadsGoToReplicasAndWritesToPrimary(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Seed a replica that has drifted from the primary
+	replicaPath := filepath.Join(dir, "replica.db")
+	replica := database.NewDatabaseManager()
+	replica.Connect("replica", database.DatabaseConfig{Driver: "sqlite", Database: replicaPath})
+	connection(t, replica).AutoMigrate(&Account{})
+	connection(t, replica).Create(&Account{Name: "from replica"})
+	replica.Close()
+
+	dm := database.NewDatabaseManager()
+	t.Cleanup(func() { dm.Close() })
+	err := dm.Connect("app", database.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(dir, "primary.db"),
+		Read:     []string{replicaPath},
+		Sticky:   true,
+	})
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	primary := connection(t, dm).WithContext(database.UsePrimary(ctx))
+	primary.AutoMigrate(&Account{})
+
+	names := func(db *gorm.DB) []string {
+		var names []string
+		db.Model(&Account{}).Order("id").Pluck("name", &names)
+		return names
+	}
+
+	if got := names(connection(t, dm)); len(got) != 1 || got[0] != "from replica" {
+		t.Errorf("Expected reads from the replica, got %v", got)
+	}
+
+	connection(t, dm).Create(&Account{Name: "written"})
+	if got := names(primary); len(got) != 1 || got[0] != "written" {
+		t.Errorf("Expected the write on the primary, got %v", got)
+	}
+	model := database.NewModel(connection(t, dm))
+	if count, _ := model.UsePrimary().Query().Model(&Account{}).Count(); count != 1 {
+		t.Errorf("Expected forced primary read to see the write, got %d", count)
+	}
+
+	// A sticky context reads its own writes
+	request := connection(t, dm).WithContext(database.StickyContext(ctx))
+	if got := names(request); got[0] != "from replica" {
+		t.Errorf("Expected replica reads before a write, got %v", got)
+	}
+	request.Create(&Account{Name: "sticky"})
+	if got := names(request); len(got) != 2 || got[1] != "sticky" {
+		t.Errorf("Expected primary reads after a write, got %v", got)
+	}
+
+	// Unreachable replicas are skipped
+	err = dm.Connect("degraded", database.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(dir, "primary.db"),
+		Read:     []string{filepath.Join(dir, "missing", "replica.db")},
+	})
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if got := names(connection(t, dm, "degraded")); len(got) != 2 {
+		t.Errorf("Expected reads from the primary while the replica is down, got %v", got)
+	}
+}
+
+func TestConnectDatabasesAppliesConnectionOptions(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "logs", "gorm.log")
+
+	app, err := framework.New(framework.Config{
+		Database: &config.DatabaseConfig{
+			Default: "main",
+			Connections: map[string]config.DatabaseConnection{
+				"main": {
+					Driver:       "sqlite",
+					Database:     filepath.Join(dir, "app.db"),
+					Options:      map[string]string{"_busy_timeout": "5000"},
+					MaxOpenConns: 3,
+					LogLevel:     "info",
+					LogFile:      logFile,
+					PrepareStmt:  true,
+				},
+				"other": {Driver: "sqlite", Database: filepath.Join(dir, "other.db"), LogLevel: "silent"},
+			},
+		},
+		Cache: &config.CacheConfig{
+			Default: "local",
+			Stores:  map[string]config.CacheStore{"local": {Driver: "memory"}},
+		},
+		Queue: &config.QueueConfig{
+			Default:     "sync",
+			Connections: map[string]config.QueueConnection{"sync": {Driver: "sync", Queue: "default"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("framework.New: %v", err)
+	}
+	if err := app.ConnectDatabases(context.Background()); err != nil {
+		t.Fatalf("ConnectDatabases failed: %v", err)
+	}
+	t.Cleanup(func() { app.DB.Close() })
+
+	db := connection(t, app.DB)
+	if err := db.AutoMigrate(&Account{}); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+
+	sqlDB, _ := db.DB()
+	if max := sqlDB.Stats().MaxOpenConnections; max != 3 {
+		t.Errorf("Expected 3 max open connections, got %d", max)
+	}
+	var timeout int
+	db.Raw("PRAGMA busy_timeout").Scan(&timeout)
+	if timeout != 5000 {
+		t.Errorf("Expected the DSN option to set busy_timeout, got %d", timeout)
+	}
+
+	db.Create(&Account{Name: "logged"})
+	if contents, _ := os.ReadFile(logFile); !strings.Contains(string(contents), "INSERT INTO `accounts`") {
+		t.Errorf("Expected statements in the log file, got %q", contents)
+	}
+
+	err = database.NewDatabaseManager().Connect("bad", database.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(dir, "bad.db"),
+		LogLevel: "loud",
+	})
+	if err == nil {
+		t.Error("Expected an unknown log level to be rejected")
+	}
+}
+
+func TestConnectionErrorsHealthAndReconnect(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	dm := database.NewDatabaseManager()
+	t.Cleanup(func() { dm.Close() })
+	if _, err := dm.Connection(); !errors.Is(err, database.ErrConnectionNotFound) {
+		t.Errorf("Expected ErrConnectionNotFound without connections, got %v", err)
+	}
+
+	// Registered connections only open on first use
+	lazyPath := filepath.Join(dir, "lazy.db")
+	dm.Register("lazy", database.DatabaseConfig{Driver: "sqlite", Database: lazyPath})
+	if _, err := os.Stat(lazyPath); err == nil {
+		t.Error("Expected the connection to wait for its first use")
+	}
+	connection(t, dm).AutoMigrate(&Account{})
+	if _, err := dm.Connection("missing"); !errors.Is(err, database.ErrConnectionNotFound) {
+		t.Errorf("Expected ErrConnectionNotFound for an unknown name, got %v", err)
+	}
+
+	// A database that is down fails fast until its backoff delay has passed
+	downDir := filepath.Join(dir, "down")
+	dm.Register("down", database.DatabaseConfig{Driver: "sqlite", Database: filepath.Join(downDir, "app.db")})
+	if _, err := dm.Connection("down"); err == nil {
+		t.Fatal("Expected an error while the database is down")
+	}
+	if _, err := dm.Connection("down"); err == nil || !strings.Contains(err.Error(), "retrying in") {
+		t.Errorf("Expected the retry to wait for the backoff delay, got %v", err)
+	}
+	if err := dm.Ping(ctx); err == nil {
+		t.Error("Expected Ping to report the connection that is down")
+	}
+	health := dm.Health()
+	if !health["lazy"].Healthy || health["down"].Healthy || health["down"].Error == "" {
+		t.Errorf("Expected lazy to be healthy and down to be down, got %+v", health)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := dm.WaitForConnections(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected WaitForConnections to give up at the deadline, got %v", err)
+	}
+
+	// Once the database is back, WaitForConnections connects it
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.MkdirAll(downDir, 0755)
+	}()
+	waitCtx, cancel = context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := dm.WaitForConnections(waitCtx); err != nil {
+		t.Fatalf("WaitForConnections failed: %v", err)
+	}
+	if err := dm.Ping(ctx); err != nil {
+		t.Errorf("Expected every connection to be up, got %v", err)
+	}
+	if health := dm.Health()["down"]; !health.Healthy || health.Open == 0 {
+		t.Errorf("Expected the reconnected database to be healthy, got %+v", health)
+	}
+}
+
+func TestSchemaBuilderCompilesForEachDriver(t *testing.T) {
+	posts := func(t *schema.Blueprint) {
+		t.ID()
+		t.String("title", 255)
+		t.ForeignID("user_id").Constrained().CascadeOnDelete()
+		t.Boolean("published").Default(false)
+		t.Timestamps()
+		t.SoftDeletes()
+	}
+
+	expected := map[string][]string{
+		"mysql": {
+			"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY",
+			"`user_id` BIGINT UNSIGNED NOT NULL",
+			"CONSTRAINT `fk_posts_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE",
+			"`created_at` TIMESTAMP NULL",
+			"CREATE INDEX `idx_posts_deleted_at` ON `posts` (`deleted_at`)",
+		},
+		"postgres": {
+			`"id" BIGSERIAL PRIMARY KEY`,
+			`"user_id" BIGINT NOT NULL`,
+			`"published" BOOLEAN NOT NULL DEFAULT FALSE`,
+			`"created_at" TIMESTAMPTZ NULL`,
+			`CREATE INDEX "idx_posts_deleted_at" ON "posts" ("deleted_at")`,
+		},
+		"sqlite": {
+			`"id" INTEGER PRIMARY KEY AUTOINCREMENT`,
+			`"created_at" DATETIME NULL`,
+		},
+	}
+	for dialect, fragments := range expected {
+		statements, err := schema.CreateSQL(dialect, "posts", posts)
+		if err != nil {
+			t.Fatalf("%s: CreateSQL failed: %v", dialect, err)
+		}
+		sql := strings.Join(statements, ";\n")
+		for _, fragment := range fragments {
+			if !strings.Contains(sql, fragment) {
+				t.Errorf("%s: expected %q in:\n%s", dialect, fragment, sql)
+			}
+		}
+	}
+
+	statements, _ := schema.TableSQL("mysql", "posts", func(t *schema.Blueprint) {
+		t.DropForeign("fk_posts_user_id")
+		t.DropIndex("idx_posts_deleted_at")
+	})
+	if len(statements) != 2 || statements[1] != "DROP INDEX `idx_posts_deleted_at` ON `posts`" {
+		t.Errorf("Unexpected MySQL alterations: %v", statements)
+	}
+	if _, err := schema.TableSQL("sqlite", "posts", func(t *schema.Blueprint) { t.DropForeign("fk_posts_user_id") }); err == nil {
+		t.Error("Expected SQLite to refuse to drop a foreign key")
+	}
+
+	// SQLite needs a constant value for the rows a new column is added to
+	for name, column := range map[string]func(t *schema.Blueprint){
+		"not null":   func(t *schema.Blueprint) { t.String("slug") },
+		"raw":        func(t *schema.Blueprint) { t.Timestamp("published_at").Default(schema.Raw("CURRENT_TIMESTAMP")) },
+		"increments": func(t *schema.Blueprint) { t.ID("number") },
+	} {
+		if _, err := schema.TableSQL("sqlite", "posts", column); err == nil {
+			t.Errorf("Expected SQLite to refuse to add a %s column", name)
+		}
+		if _, err := schema.TableSQL("postgres", "posts", column); err != nil {
+			t.Errorf("Expected Postgres to add a %s column, got %v", name, err)
+		}
+	}
+	for _, column := range []func(t *schema.Blueprint){
+		func(t *schema.Blueprint) { t.String("slug").Default("") },
+		func(t *schema.Blueprint) { t.Timestamp("published_at").Nullable() },
+	} {
+		if _, err := schema.TableSQL("sqlite", "posts", column); err != nil {
+			t.Errorf("Expected SQLite to add the column, got %v", err)
+		}
+	}
+}
+
+func TestSchemaBuilderMigratesSQLite(t *testing.T) {
+	dm := database.NewDatabaseManager()
+	t.Cleanup(func() { dm.Close() })
+	err := dm.Connect("app", database.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(t.TempDir(), "app.db"),
+		Options:  map[string]string{"_foreign_keys": "1"},
+		LogLevel: "silent",
+	})
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	db := connection(t, dm)
+
+	// The sample users migration runs on SQLite
+	if err := migrations.RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+
+	builder := schema.New(db)
+	err = builder.Create("posts", func(t *schema.Blueprint) {
+		t.ID()
+		t.String("title")
+		t.ForeignID("user_id").Constrained().CascadeOnDelete()
+		t.Timestamps()
+		t.SoftDeletes()
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !db.Migrator().HasIndex("posts", "idx_posts_deleted_at") {
+		t.Error("Expected SoftDeletes to index deleted_at")
+	}
+
+	if err := db.Exec("INSERT INTO users (name, email, password) VALUES ('jane', 'jane@example.com', 'secret')").Error; err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := db.Exec("INSERT INTO posts (title, user_id) VALUES ('hello', 1)").Error; err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := db.Exec("INSERT INTO posts (title, user_id) VALUES ('orphan', 99)").Error; err == nil {
+		t.Error("Expected the foreign key to reject an unknown user")
+	}
+
+	err = builder.Table("posts", func(t *schema.Blueprint) {
+		t.Integer("views").Default(0)
+		t.ForeignID("editor_id").Nullable().Constrained("users").NullOnDelete()
+		t.RenameColumn("title", "headline")
+	})
+	if err != nil {
+		t.Fatalf("Table failed: %v", err)
+	}
+	for _, column := range []string{"views", "editor_id", "headline"} {
+		if !db.Migrator().HasColumn("posts", column) {
+			t.Errorf("Expected column %s after the alteration", column)
+		}
+	}
+
+	db.Exec("DELETE FROM users")
+	var count int64
+	db.Table("posts").Count(&count)
+	if count != 0 {
+		t.Errorf("Expected posts to be deleted with their user, got %d", count)
+	}
+
+	if err := builder.Rename("posts", "articles"); err != nil || !builder.HasTable("articles") {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := builder.Drop("articles"); err != nil || builder.HasTable("articles") {
+		t.Errorf("Drop failed: %v", err)
+	}
+	if err := migrations.RollbackMigrations(db, 2); err != nil || builder.HasTable("users") {
+		t.Errorf("Expected the users migration to roll back, got %v", err)
+	}
+}
@@ -0,0 +1,843 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/test/myapp/framework/cache"
+	"github.com/test/myapp/framework/events"
+	"github.com/test/myapp/framework/queue"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// FlakyJob always fails, like a mail server that is down
+type FlakyJob struct {
+	queue.BaseJob
+}
+
+func (j *FlakyJob) Handle() error {
+	return errors.New("smtp unavailable")
+}
+
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met before timeout")
+}
+
+func TestQueueRetriesAndStoresFailedJobs(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+	qm.SetRetryPolicy(queue.RetryPolicy{MaxAttempts: 3, Backoff: queue.FixedBackoff{}})
+	qm.RegisterJob("flaky", func() queue.Job { return &FlakyJob{} })
+
+	if err := qm.Dispatch(&queue.BaseJob{Name: "flaky", Payload: map[string]interface{}{"to": "a@b.c"}}); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	qm.StartWorker("default", 1)
+	defer qm.StopWorker("default")
+
+	var failed []queue.FailedJob
+	waitFor(t, 2*time.Second, func() bool {
+		failed, _ = qm.FailedJobs()
+		return len(failed) == 1
+	})
+
+	if failed[0].Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", failed[0].Attempts)
+	}
+	if failed[0].Exception != "smtp unavailable" {
+		t.Errorf("Unexpected exception: %s", failed[0].Exception)
+	}
+
+	if err := qm.ForgetFailedJob(failed[0].ID); err != nil {
+		t.Errorf("ForgetFailedJob failed: %v", err)
+	}
+}
+
+// WelcomeJob keeps its data in struct fields rather than the payload map
+type WelcomeJob struct {
+	queue.BaseJob
+	Email string `json:"email"`
+}
+
+var welcomed = make(chan string, 1)
+
+func (j *WelcomeJob) Handle() error {
+	welcomed <- j.Email
+	return nil
+}
+
+func TestTypedJobHydratesStructFields(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+	queue.RegisterTypedJob[WelcomeJob](qm, "welcome")
+
+	job := &WelcomeJob{BaseJob: queue.BaseJob{Name: "welcome"}, Email: "jane@example.com"}
+	if err := qm.Dispatch(job); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	qm.StartWorker("default", 1)
+	defer qm.StopWorker("default")
+
+	select {
+	case email := <-welcomed:
+		if email != "jane@example.com" {
+			t.Errorf("Expected hydrated email, got %q", email)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job was not processed")
+	}
+}
+
+func TestUniqueJobRejectsPendingDuplicate(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+	store := cache.NewMemoryCache("test")
+
+	onDispatch, _ := queue.UniqueJob(store, func(job queue.Job) string {
+		return job.(*WelcomeJob).Email
+	}, time.Minute)
+	qm.UseDispatch(onDispatch)
+
+	first := &WelcomeJob{BaseJob: queue.BaseJob{Name: "welcome"}, Email: "jane@example.com"}
+	if err := qm.Dispatch(first); err != nil {
+		t.Fatalf("First dispatch failed: %v", err)
+	}
+
+	duplicate := &WelcomeJob{BaseJob: queue.BaseJob{Name: "welcome"}, Email: "jane@example.com"}
+	if err := qm.Dispatch(duplicate); !errors.Is(err, queue.ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob, got %v", err)
+	}
+
+	if size, _ := qm.Queue().Size(); size != 1 {
+		t.Errorf("Expected 1 queued job, got %d", size)
+	}
+}
+
+func TestBatchCallbacksAndChain(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+	qm.SetRetryPolicy(queue.RetryPolicy{MaxAttempts: 1})
+	queue.RegisterTypedJob[WelcomeJob](qm, "welcome")
+	qm.RegisterJob("flaky", func() queue.Job { return &FlakyJob{} })
+
+	finished := make(chan *queue.Batch, 1)
+	caught := make(chan error, 1)
+	batch, err := qm.Batch(
+		&WelcomeJob{BaseJob: queue.BaseJob{Name: "welcome"}, Email: "a@example.com"},
+		&queue.BaseJob{Name: "flaky"},
+	).Then(func(b *queue.Batch) {
+		t.Error("Then should not run when a job failed")
+	}).Catch(func(b *queue.Batch, err error) {
+		caught <- err
+	}).Finally(func(b *queue.Batch) {
+		finished <- b
+	}).Dispatch()
+	if err != nil {
+		t.Fatalf("Batch dispatch failed: %v", err)
+	}
+
+	qm.StartWorker("default", 2)
+	defer qm.StopWorker("default")
+
+	select {
+	case b := <-finished:
+		if b.ID != batch.ID || b.FailedJobs != 1 || !b.Finished() {
+			t.Errorf("Unexpected batch state: %+v", b)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("batch did not finish")
+	}
+	<-welcomed
+	if err := <-caught; err == nil {
+		t.Error("Expected Catch to receive the job error")
+	}
+
+	// A chain stops at the failing job, so the welcome job never runs
+	if err := qm.Chain(&queue.BaseJob{Name: "flaky"}, &WelcomeJob{BaseJob: queue.BaseJob{Name: "welcome"}}).Dispatch(); err != nil {
+		t.Fatalf("Chain dispatch failed: %v", err)
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		failed, _ := qm.FailedJobs()
+		return len(failed) == 2
+	})
+	select {
+	case <-welcomed:
+		t.Error("Chained job ran after a failure")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBatchAndChainJobsRunDispatchMiddleware(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+	for _, name := range []string{"chain-1", "chain-2"} {
+		qm.RegisterJob(name, func() queue.Job { return &queue.BaseJob{} })
+	}
+
+	var (
+		mutex      sync.Mutex
+		dispatched []string
+	)
+	qm.UseDispatch(func(job queue.Job, next func() error) error {
+		mutex.Lock()
+		dispatched = append(dispatched, job.GetName())
+		mutex.Unlock()
+		return next()
+	})
+	store := cache.NewMemoryCache("test")
+	onDispatch, _ := queue.UniqueJob(store, func(job queue.Job) string { return job.GetName() }, time.Minute)
+	qm.UseDispatch(onDispatch)
+
+	if _, err := qm.Batch(&queue.BaseJob{Name: "batch-a"}, &queue.BaseJob{Name: "batch-b"}).Dispatch(); err != nil {
+		t.Fatalf("Batch dispatch failed: %v", err)
+	}
+	if err := qm.Chain(&queue.BaseJob{Name: "chain-1"}, &queue.BaseJob{Name: "chain-2"}).Dispatch(); err != nil {
+		t.Fatalf("Chain dispatch failed: %v", err)
+	}
+	if _, err := qm.Batch(&queue.BaseJob{Name: "batch-a"}).Dispatch(); !errors.Is(err, queue.ErrDuplicateJob) {
+		t.Errorf("Expected the unique guard to reject a batch job, got %v", err)
+	}
+
+	// The next job of the chain is dispatched once the first one finishes
+	qm.StartWorker("default", 1)
+	defer qm.StopWorker("default")
+	waitFor(t, 2*time.Second, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(dispatched) == 5
+	})
+	mutex.Lock()
+	defer mutex.Unlock()
+	if got := strings.Join(dispatched, ","); got != "batch-a,batch-b,chain-1,batch-a,chain-2" {
+		t.Errorf("Unexpected dispatches: %s", got)
+	}
+}
+
+// RecordJob records the order jobs are handled in
+type RecordJob struct {
+	queue.BaseJob
+	Label string `json:"label"`
+}
+
+var recorded = make(chan string, 10)
+
+func (j *RecordJob) Handle() error {
+	recorded <- j.Label
+	return nil
+}
+
+func TestPriorityWorkerDrainsHigherQueuesFirst(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("high", &queue.MemoryQueue{})
+	qm.AddQueue("low", &queue.MemoryQueue{})
+	queue.RegisterTypedJob[RecordJob](qm, "record")
+
+	for _, label := range []string{"newsletter-1", "newsletter-2"} {
+		qm.Dispatch(&RecordJob{BaseJob: queue.BaseJob{Name: "record"}, Label: label}, "low")
+	}
+	qm.Dispatch(&RecordJob{BaseJob: queue.BaseJob{Name: "record"}, Label: "password-reset"}, "high")
+
+	qm.StartWorker("high,low", 1)
+	defer qm.StopWorker("high,low")
+
+	for i, want := range []string{"password-reset", "newsletter-1", "newsletter-2"} {
+		select {
+		case got := <-recorded:
+			if got != want {
+				t.Errorf("Job %d: expected %s, got %s", i, want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("job was not processed")
+		}
+	}
+}
+
+func TestWorkerReportsLifecycleEventsAndMetrics(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+	qm.SetRetryPolicy(queue.RetryPolicy{MaxAttempts: 2, Backoff: queue.FixedBackoff{}})
+	qm.RegisterJob("flaky", func() queue.Job { return &FlakyJob{} })
+
+	dispatcher := events.NewEventDispatcher()
+	seen := make(chan string, 10)
+	for _, name := range []string{queue.EventJobProcessing, queue.EventJobRetrying, queue.EventJobFailed} {
+		dispatcher.ListenFunc(name, func(event events.Event) error {
+			seen <- event.GetName()
+			return nil
+		})
+	}
+	qm.SetEventDispatcher(dispatcher)
+
+	qm.Dispatch(&queue.BaseJob{Name: "flaky"})
+	qm.StartWorker("default", 1)
+	defer qm.StopWorker("default")
+
+	expected := []string{
+		queue.EventJobProcessing, queue.EventJobRetrying,
+		queue.EventJobProcessing, queue.EventJobFailed,
+	}
+	for _, want := range expected {
+		select {
+		case got := <-seen:
+			if got != want {
+				t.Fatalf("Expected event %s, got %s", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Event %s was not dispatched", want)
+		}
+	}
+
+	stats := qm.Metrics().Snapshot()["flaky"]
+	if stats.Retried != 1 || stats.Failed != 1 || stats.Latency.Count != 2 {
+		t.Errorf("Unexpected metrics: %+v", stats)
+	}
+
+	statuses, err := qm.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Failed != 1 || statuses[0].Pending != 0 {
+		t.Errorf("Unexpected queue status: %+v", statuses)
+	}
+}
+
+func TestCancelledContextStopsDispatchAndCacheReads(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := qm.DispatchCtx(ctx, &queue.BaseJob{Name: "noop"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected DispatchCtx to fail with context.Canceled, got %v", err)
+	}
+	if size, _ := qm.Queue().Size(); size != 0 {
+		t.Errorf("Expected nothing to be queued, got %d jobs", size)
+	}
+
+	store := cache.NewMemoryCache("test")
+	defer store.Close()
+	store.Set("greeting", "hello", time.Minute)
+
+	var value string
+	if err := store.GetCtx(ctx, "greeting", &value); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected GetCtx to fail with context.Canceled, got %v", err)
+	}
+	err := store.RememberCtx(ctx, "other", time.Minute, func() (interface{}, error) {
+		t.Error("Remember ran its callback on a cancelled context")
+		return "", nil
+	}, &value)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected RememberCtx to fail with context.Canceled, got %v", err)
+	}
+}
+
+func TestSyncQueueRunsJobsInline(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", queue.NewSyncQueue(qm, "default"))
+	queue.RegisterTypedJob[WelcomeJob](qm, "welcome")
+	qm.RegisterJob("flaky", func() queue.Job { return &FlakyJob{} })
+
+	job := &WelcomeJob{BaseJob: queue.BaseJob{Name: "welcome"}, Email: "jane@example.com"}
+	if err := qm.Dispatch(job); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	// The job has already run when Dispatch returns
+	select {
+	case email := <-welcomed:
+		if email != "jane@example.com" {
+			t.Errorf("Expected hydrated email, got %q", email)
+		}
+	default:
+		t.Fatal("job did not run inline")
+	}
+
+	if err := qm.Dispatch(&queue.BaseJob{Name: "flaky"}); err == nil || err.Error() != "smtp unavailable" {
+		t.Errorf("Expected the job's error from Dispatch, got %v", err)
+	}
+	if failed, _ := qm.FailedJobs(); len(failed) != 0 {
+		t.Errorf("Expected no stored failed jobs, got %d", len(failed))
+	}
+}
+
+func TestDatabaseQueueDelaysReservesAndReleases(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "jobs.db")+"?_busy_timeout=5000"), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	_, up, _ := queue.CreateJobsTableMigration()
+	if err := up(db); err != nil {
+		t.Fatalf("create jobs table: %v", err)
+	}
+
+	dq := queue.NewDatabaseQueue(db, "default")
+	dq.SetVisibilityTimeout(50 * time.Millisecond)
+
+	dq.Push(&queue.BaseJob{Name: "now"})
+	dq.Push(&queue.BaseJob{Name: "later"}, time.Hour)
+
+	stats, _ := dq.Stats()
+	if stats.Pending != 1 || stats.Delayed != 1 {
+		t.Errorf("Expected 1 pending and 1 delayed job, got %+v", stats)
+	}
+
+	job, err := dq.Pop()
+	if err != nil || job == nil || job.GetName() != "now" {
+		t.Fatalf("Expected the ready job, got %v, %v", job, err)
+	}
+	if next, _ := dq.Pop(); next != nil {
+		t.Fatalf("Expected no job while the other is delayed, got %s", next.GetName())
+	}
+
+	// An unacknowledged job becomes available again after the timeout
+	time.Sleep(60 * time.Millisecond)
+	stale := job
+	job, _ = dq.Pop()
+	if job == nil || job.GetName() != "now" {
+		t.Fatal("Expected the expired reservation to be popped again")
+	}
+
+	// Only the latest pop can finish the job, and releasing a job that is
+	// not reserved queues nothing
+	dq.Ack(stale)
+	dq.Release(stale)
+	dq.Release(&queue.BaseJob{ID: job.GetID(), Name: "now"})
+	stats, _ = dq.Stats()
+	if stats.Reserved != 1 || stats.Pending != 0 {
+		t.Errorf("Expected the job to stay reserved by the latest pop, got %+v", stats)
+	}
+
+	job.SetAttempts(1)
+	if err := dq.Release(job); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	job, _ = dq.Pop()
+	if job == nil || job.GetAttempts() != 1 {
+		t.Fatalf("Expected the released job with its attempts, got %v", job)
+	}
+	var row queue.DatabaseJob
+	if err := db.Where("payload LIKE ?", "%"+job.GetID()+"%").First(&row).Error; err != nil || row.Attempts != 1 {
+		t.Errorf("Expected the attempts column to match the job, got %d, %v", row.Attempts, err)
+	}
+	if err := dq.Ack(job); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+
+	stats, _ = dq.Stats()
+	if stats != (queue.QueueStats{Delayed: 1}) {
+		t.Errorf("Expected only the delayed job left, got %+v", stats)
+	}
+
+	// Concurrent workers never reserve the same job
+	dq.Clear()
+	dq.SetVisibilityTimeout(time.Minute)
+	for i := 0; i < 20; i++ {
+		dq.Push(&queue.BaseJob{Name: "batch"})
+	}
+	var (
+		seen  sync.Map
+		dupes atomic.Int32
+		wg    sync.WaitGroup
+	)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := dq.Pop()
+				if err != nil {
+					t.Errorf("Pop failed: %v", err)
+					return
+				}
+				if job == nil {
+					return
+				}
+				if _, loaded := seen.LoadOrStore(job.GetID(), true); loaded {
+					dupes.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if dupes.Load() != 0 {
+		t.Errorf("Expected no duplicate reservations, got %d", dupes.Load())
+	}
+	if stats, _ := dq.Stats(); stats.Reserved != 20 {
+		t.Errorf("Expected all 20 jobs reserved, got %+v", stats)
+	}
+}
+
+// reservingQueue is a queue whose reservations expire and can be extended
+type reservingQueue interface {
+	queue.Queue
+	queue.Extender
+	SetVisibilityTimeout(timeout time.Duration)
+	ReapExpired() (int64, error)
+}
+
+// newRedis starts an in-process Redis server and connects to it
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+// newRedisQueue returns a RedisQueue on an in-process Redis server
+func newRedisQueue(t *testing.T, name string) *queue.RedisQueue {
+	_, client := newRedis(t)
+	rq := queue.NewRedisQueue(client, name)
+	rq.SetBlockTimeout(0)
+	return rq
+}
+
+func TestMemoryQueueReservations(t *testing.T) {
+	testReservations(t, &queue.MemoryQueue{})
+}
+
+func TestRedisQueueReservations(t *testing.T) {
+	testReservations(t, newRedisQueue(t, "default"))
+}
+
+func testReservations(t *testing.T, q reservingQueue) {
+	const timeout = 200 * time.Millisecond
+	q.SetVisibilityTimeout(timeout)
+
+	mustPop := func(name string) queue.Job {
+		t.Helper()
+		job, err := q.Pop()
+		if err != nil || job == nil || job.GetName() != name {
+			t.Fatalf("Expected job %s, got %v, %v", name, job, err)
+		}
+		return job
+	}
+	mustBeEmpty := func() {
+		t.Helper()
+		if job, err := q.Pop(); job != nil || err != nil {
+			t.Fatalf("Expected no job, got %v, %v", job, err)
+		}
+	}
+
+	// An acknowledged job is never delivered again
+	q.Push(&queue.BaseJob{Name: "ack"})
+	if err := q.Ack(mustPop("ack")); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+	time.Sleep(timeout + 50*time.Millisecond)
+	mustBeEmpty()
+
+	// A released job comes back with its new attempts
+	q.Push(&queue.BaseJob{Name: "release"})
+	job := mustPop("release")
+	job.SetAttempts(1)
+	if err := q.Release(job); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	job = mustPop("release")
+	if job.GetAttempts() != 1 {
+		t.Errorf("Expected 1 attempt after release, got %d", job.GetAttempts())
+	}
+	q.Ack(job)
+
+	// A job that is not acknowledged in time is reaped and redelivered once,
+	// even if its first worker releases it late
+	q.Push(&queue.BaseJob{Name: "crash"})
+	first := mustPop("crash")
+	mustBeEmpty()
+	time.Sleep(timeout + 50*time.Millisecond)
+	if reaped, err := q.ReapExpired(); reaped != 1 || err != nil {
+		t.Fatalf("Expected 1 reaped job, got %d, %v", reaped, err)
+	}
+	if err := q.Release(first); err != nil {
+		t.Fatalf("Release after reap failed: %v", err)
+	}
+	if size, _ := q.Size(); size != 1 {
+		t.Fatalf("Expected the reaped job once, got %d jobs", size)
+	}
+	again := mustPop("crash")
+	if again.GetID() != first.GetID() {
+		t.Errorf("Expected job %s to be redelivered, got %s", first.GetID(), again.GetID())
+	}
+	mustBeEmpty()
+	q.Ack(again)
+
+	// Extending a reservation keeps a long job from being redelivered
+	q.Push(&queue.BaseJob{Name: "long"})
+	job = mustPop("long")
+	time.Sleep(timeout * 3 / 5)
+	if err := q.ExtendCtx(context.Background(), job); err != nil {
+		t.Fatalf("Extend failed: %v", err)
+	}
+	time.Sleep(timeout * 3 / 5)
+	mustBeEmpty()
+	q.Ack(job)
+	if err := q.ExtendCtx(context.Background(), job); !errors.Is(err, queue.ErrNotReserved) {
+		t.Errorf("Expected ErrNotReserved after Ack, got %v", err)
+	}
+}
+
+// SlowJob runs for longer than its queue's visibility timeout
+type SlowJob struct {
+	queue.BaseJob
+}
+
+var slowRuns atomic.Int32
+
+func (j *SlowJob) Handle() error {
+	slowRuns.Add(1)
+	time.Sleep(300 * time.Millisecond)
+	return nil
+}
+
+func TestWorkerExtendsReservationOfLongJobs(t *testing.T) {
+	rq := newRedisQueue(t, "default")
+	rq.SetVisibilityTimeout(100 * time.Millisecond)
+
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", rq)
+	qm.RegisterJob("slow", func() queue.Job { return &SlowJob{} })
+	slowRuns.Store(0)
+
+	qm.StartWorker("default", 2)
+	defer qm.StopWorker("default")
+
+	if err := qm.Dispatch(&queue.BaseJob{Name: "slow"}); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	// Without extensions the idle worker would reap and run the job again
+	waitFor(t, time.Second, func() bool { return slowRuns.Load() == 1 })
+	waitFor(t, time.Second, func() bool {
+		stats, _ := rq.Stats()
+		return stats == queue.QueueStats{}
+	})
+	if runs := slowRuns.Load(); runs != 1 {
+		t.Errorf("Expected the job to run once, ran %d times", runs)
+	}
+}
+
+func TestRedisQueuePopBlocksUntilPush(t *testing.T) {
+	rq := newRedisQueue(t, "default")
+	rq.SetBlockTimeout(2 * time.Second)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		rq.Push(&queue.BaseJob{Name: "wake"})
+	}()
+
+	started := time.Now()
+	job, err := rq.Pop()
+	if err != nil || job == nil || job.GetName() != "wake" {
+		t.Fatalf("Expected Pop to wait for the pushed job, got %v, %v", job, err)
+	}
+	if waited := time.Since(started); waited > time.Second {
+		t.Errorf("Expected Pop to return as soon as the job was pushed, waited %s", waited)
+	}
+}
+
+func TestMemoryQueueDelayedJobs(t *testing.T) {
+	testDelayedJobs(t, &queue.MemoryQueue{})
+}
+
+func TestRedisQueueDelayedJobs(t *testing.T) {
+	testDelayedJobs(t, newRedisQueue(t, "default"))
+}
+
+func testDelayedJobs(t *testing.T, q queue.Queue) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", q)
+
+	now := time.Now()
+	for name, delay := range map[string]time.Duration{
+		"third":  300 * time.Millisecond,
+		"first":  100 * time.Millisecond,
+		"second": 200 * time.Millisecond,
+	} {
+		if err := qm.Later(now.Add(delay), &queue.BaseJob{Name: name}); err != nil {
+			t.Fatalf("Later failed: %v", err)
+		}
+	}
+
+	popNames := func() []string {
+		t.Helper()
+		var names []string
+		for {
+			job, err := q.Pop()
+			if err != nil {
+				t.Fatalf("Pop failed: %v", err)
+			}
+			if job == nil {
+				return names
+			}
+			names = append(names, job.GetName())
+			q.Ack(job)
+		}
+	}
+
+	if names := popNames(); len(names) != 0 {
+		t.Fatalf("Expected delayed jobs to stay invisible, got %v", names)
+	}
+
+	time.Sleep(time.Until(now.Add(150 * time.Millisecond)))
+	if names := popNames(); len(names) != 1 || names[0] != "first" {
+		t.Fatalf("Expected only the first job to be due, got %v", names)
+	}
+
+	time.Sleep(time.Until(now.Add(350 * time.Millisecond)))
+	if names := popNames(); len(names) != 2 || names[0] != "second" || names[1] != "third" {
+		t.Errorf("Expected the other jobs in delay order, got %v", names)
+	}
+}
+
+// GateJob runs until its gate is opened
+type GateJob struct {
+	queue.BaseJob
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func (j *GateJob) Handle() error {
+	j.started <- struct{}{}
+	<-j.gate
+	return nil
+}
+
+func TestWorkerStopDrainsOrReleasesRunningJobs(t *testing.T) {
+	started, gate := make(chan struct{}, 1), make(chan struct{})
+	handlers := map[string]func() queue.Job{
+		"gate": func() queue.Job { return &GateJob{started: started, gate: gate} },
+	}
+
+	// A job that finishes before the deadline is drained and acknowledged
+	mq := &queue.MemoryQueue{}
+	worker := queue.NewWorker(mq, handlers, 1)
+	go worker.Start()
+	mq.Push(&queue.BaseJob{Name: "gate"})
+	<-started
+
+	time.AfterFunc(50*time.Millisecond, func() { gate <- struct{}{} })
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := worker.StopContext(ctx); err != nil {
+		t.Fatalf("Expected the worker to drain, got %v", err)
+	}
+	if stats, _ := mq.Stats(); stats != (queue.QueueStats{}) {
+		t.Errorf("Expected the drained job to be acknowledged, got %+v", stats)
+	}
+	if err := worker.StopContext(ctx); err != nil {
+		t.Errorf("Expected a second stop to succeed, got %v", err)
+	}
+
+	// A job still running at the deadline is released once; finishing later
+	// neither acknowledges nor releases it again
+	mq = &queue.MemoryQueue{}
+	worker = queue.NewWorker(mq, handlers, 1)
+	go worker.Start()
+	mq.Push(&queue.BaseJob{Name: "gate"})
+	<-started
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := worker.StopContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be reported, got %v", err)
+	}
+	if size, _ := mq.Size(); size != 1 {
+		t.Fatalf("Expected the running job to be released, got %d jobs", size)
+	}
+
+	close(gate)
+	worker.Stop()
+	if size, _ := mq.Size(); size != 1 {
+		t.Errorf("Expected the released job once after it finished, got %d jobs", size)
+	}
+	if job, _ := mq.Pop(); job == nil || job.GetName() != "gate" || job.GetAttempts() != 0 {
+		t.Errorf("Expected the released job with no attempts counted, got %v", job)
+	}
+}
+
+// CallbackJob cannot be serialized, so dispatching it fails
+type CallbackJob struct {
+	queue.BaseJob
+	Callback func()
+}
+
+func TestBatchDispatchFailureCleansUp(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+
+	// Nothing was queued, so the batch is removed
+	batch, err := qm.Batch(&CallbackJob{BaseJob: queue.BaseJob{Name: "callback"}}).Dispatch()
+	if err == nil {
+		t.Fatal("Expected the unserializable job to fail the batch")
+	}
+	if _, err := qm.FindBatch(batch.ID); !errors.Is(err, queue.ErrBatchNotFound) {
+		t.Errorf("Expected the empty batch to be deleted, got %v", err)
+	}
+
+	// Jobs already queued are skipped by cancelling the batch
+	batch, err = qm.Batch(
+		&queue.BaseJob{Name: "noop"},
+		&CallbackJob{BaseJob: queue.BaseJob{Name: "callback"}},
+	).Dispatch()
+	if err == nil {
+		t.Fatal("Expected the unserializable job to fail the batch")
+	}
+	if found, err := qm.FindBatch(batch.ID); err != nil || !found.Cancelled() {
+		t.Errorf("Expected the partly queued batch to be cancelled, got %+v, %v", found, err)
+	}
+}
+
+func TestBatchRepositoriesExpireBatches(t *testing.T) {
+	memory := queue.NewMemoryBatchRepository()
+	memory.SetTTL(50 * time.Millisecond)
+	memory.Store(&queue.Batch{ID: "finished", TotalJobs: 1, PendingJobs: 1})
+	memory.RecordJob("finished", false)
+	if _, err := memory.Find("finished"); err != nil {
+		t.Fatalf("Expected the batch before its TTL, got %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := memory.Find("finished"); !errors.Is(err, queue.ErrBatchNotFound) {
+		t.Errorf("Expected the batch to expire, got %v", err)
+	}
+
+	server, client := newRedis(t)
+	redisBatches := queue.NewRedisBatchRepository(client, "batches")
+	redisBatches.Store(&queue.Batch{ID: "finished", TotalJobs: 2, PendingJobs: 2})
+	server.FastForward(queue.DefaultBatchTTL - time.Minute)
+
+	// Each update keeps the batch for another TTL
+	if _, err := redisBatches.RecordJob("finished", false); err != nil {
+		t.Fatalf("RecordJob failed: %v", err)
+	}
+	server.FastForward(queue.DefaultBatchTTL - time.Minute)
+	if batch, err := redisBatches.RecordJob("finished", true); err != nil || !batch.Finished() {
+		t.Fatalf("Expected the batch to finish, got %+v, %v", batch, err)
+	}
+	server.FastForward(queue.DefaultBatchTTL)
+	if _, err := redisBatches.Find("finished"); !errors.Is(err, queue.ErrBatchNotFound) {
+		t.Errorf("Expected the finished batch to expire, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package examples
+
+import (
+	"errors"
+	"github.com/test/myapp/framework/queue"
+	"github.com/test/myapp/framework/schedule"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronExpressionNextRun(t *testing.T) {
+	cases := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"*/5 * * * *", "2024-03-10 10:02", "2024-03-10 10:05"},
+		{"0 3 * * *", "2024-03-10 10:02", "2024-03-11 03:00"},
+		{"30 9 * * mon-fri", "2024-03-09 12:00", "2024-03-11 09:30"},
+		{"0 0 1 jan *", "2024-03-10 10:02", "2025-01-01 00:00"},
+		{"0 12 15 * 5", "2024-03-10 10:02", "2024-03-15 12:00"},
+	}
+
+	for _, c := range cases {
+		cron, err := schedule.ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) failed: %v", c.expr, err)
+		}
+		from, _ := time.Parse("2006-01-02 15:04", c.from)
+		if got := cron.Next(from).Format("2006-01-02 15:04"); got != c.want {
+			t.Errorf("%q after %s: expected %s, got %s", c.expr, c.from, c.want, got)
+		}
+	}
+
+	if _, err := schedule.ParseCron("61 * * * *"); err == nil {
+		t.Error("Expected an error for an out of range minute")
+	}
+}
+
+func TestScheduleRunsDueTasksOncePerServer(t *testing.T) {
+	qm := queue.NewQueueManager()
+	qm.AddQueue("default", &queue.MemoryQueue{})
+	s := schedule.New(qm)
+
+	runs := 0
+	s.Call("report", func() error {
+		runs++
+		return nil
+	}).DailyAt("02:00").Timezone("UTC").OnOneServer()
+	s.Job(&queue.BaseJob{Name: "digest"}).Hourly().Timezone("UTC")
+
+	at := time.Date(2024, 3, 10, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := s.RunDue(at); err != nil {
+			t.Fatalf("RunDue failed: %v", err)
+		}
+	}
+
+	if runs != 1 {
+		t.Errorf("Expected the report to run once, ran %d times", runs)
+	}
+	if size, _ := qm.Queue().Size(); size != 2 {
+		t.Errorf("Expected 2 dispatched digest jobs, got %d", size)
+	}
+	if due := s.DueEvents(at.Add(time.Minute)); len(due) != 0 {
+		t.Errorf("Expected nothing due at 02:01, got %d", len(due))
+	}
+}
+
+func TestRunDueReportsInvalidAndFailingTasks(t *testing.T) {
+	s := schedule.New(queue.NewQueueManager())
+	for _, name := range []string{"first", "second"} {
+		name := name
+		s.Call(name, func() error { return errors.New(name + " failed") }).EveryMinute()
+	}
+	// Listed after tasks that already run in parallel
+	s.Call("broken", func() error { return nil }).Cron("not a cron")
+
+	err := s.RunDue(time.Now())
+	for _, want := range []string{"broken", "first failed", "second failed"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %q, got %v", want, err)
+		}
+	}
+}
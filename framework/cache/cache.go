@@ -1,9 +1,12 @@
 package cache
 
 import (
+	"container/list"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,6 +20,42 @@ type Cache interface {
 	Delete(key string) error
 	Flush() error
 	Remember(key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error
+	Flexible(key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error
+	Tags(names ...string) *TaggedCache
+	
+	// Atomic primitives
+	Add(key string, value interface{}, ttl time.Duration) (bool, error)
+	Increment(key string, by int64) (int64, error)
+	Decrement(key string, by int64) (int64, error)
+	Pull(key string, dest interface{}) error
+	Forever(key string, value interface{}) error
+	Lock(name string, ttl time.Duration) Lock
+	RestoreLock(name, owner string) Lock
+	
+	// Context-aware variants; the methods above use a background context
+	GetCtx(ctx context.Context, key string, dest interface{}) error
+	SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	DeleteCtx(ctx context.Context, key string) error
+	FlushCtx(ctx context.Context) error
+	RememberCtx(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error
+	FlexibleCtx(ctx context.Context, key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error
+	AddCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	IncrementCtx(ctx context.Context, key string, by int64) (int64, error)
+	DecrementCtx(ctx context.Context, key string, by int64) (int64, error)
+	PullCtx(ctx context.Context, key string, dest interface{}) error
+	ForeverCtx(ctx context.Context, key string, value interface{}) error
+}
+
+// DefaultOperationTimeout bounds each Redis call made by a cache store
+// when the caller's context has no earlier deadline
+const DefaultOperationTimeout = 5 * time.Second
+
+// withTimeout applies an operation timeout to ctx; zero disables it
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
 // CacheManager manages different cache stores
@@ -40,6 +79,34 @@ func (cm *CacheManager) AddStore(name string, store Cache) {
 	}
 }
 
+// Close closes every store that holds connections or goroutines
+func (cm *CacheManager) Close() error {
+	var errs []error
+	for name, store := range cm.stores {
+		if closer, ok := store.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close cache store %s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetDefault sets the store returned by Store without a name
+func (cm *CacheManager) SetDefault(name string) {
+	cm.default_ = name
+}
+
+// Names returns the names of the registered stores
+func (cm *CacheManager) Names() []string {
+	names := make([]string, 0, len(cm.stores))
+	for name := range cm.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Store returns a cache store by name
 func (cm *CacheManager) Store(name ...string) Cache {
 	storeName := cm.default_
@@ -53,6 +120,13 @@ func (cm *CacheManager) Store(name ...string) Cache {
 type RedisCache struct {
 	client *redis.Client
 	prefix string
+	group  flightGroup
+	codec  codec
+	
+	timeout    time.Duration
+	lockTTL    time.Duration
+	lockWait   time.Duration
+	ownsClient bool
 }
 
 // NewRedisCache creates a new Redis cache
@@ -63,12 +137,32 @@ func NewRedisCache(addr, password string, db int, prefix string) *RedisCache {
 		DB:       db,
 	})
 	
+	rc := NewRedisCacheWithClient(rdb, prefix)
+	rc.ownsClient = true
+	return rc
+}
+
+// NewRedisCacheWithClient creates a Redis cache on a shared client, which
+// Close leaves open
+func NewRedisCacheWithClient(client *redis.Client, prefix string) *RedisCache {
 	return &RedisCache{
-		client: rdb,
-		prefix: prefix,
+		client:  client,
+		prefix:  prefix,
+		timeout: DefaultOperationTimeout,
 	}
 }
 
+// SetOperationTimeout bounds each operation when the caller's context has
+// no earlier deadline. Zero disables the timeout.
+func (rc *RedisCache) SetOperationTimeout(timeout time.Duration) {
+	rc.timeout = timeout
+}
+
+// withTimeout bounds ctx by the operation timeout
+func (rc *RedisCache) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, rc.timeout)
+}
+
 func (rc *RedisCache) key(key string) string {
 	if rc.prefix != "" {
 		return fmt.Sprintf("%s:%s", rc.prefix, key)
@@ -77,86 +171,376 @@ func (rc *RedisCache) key(key string) string {
 }
 
 func (rc *RedisCache) Get(key string, dest interface{}) error {
-	ctx := context.Background()
-	val, err := rc.client.Get(ctx, rc.key(key)).Result()
+	return rc.GetCtx(context.Background(), key, dest)
+}
+
+func (rc *RedisCache) GetCtx(ctx context.Context, key string, dest interface{}) error {
+	data, err := rc.getRaw(ctx, key)
 	if err != nil {
-		if err == redis.Nil {
-			return ErrCacheMiss
-		}
 		return err
 	}
 	
-	return json.Unmarshal([]byte(val), dest)
+	return decode(data, dest)
 }
 
 func (rc *RedisCache) Set(key string, value interface{}, ttl time.Duration) error {
-	ctx := context.Background()
-	data, err := json.Marshal(value)
+	return rc.SetCtx(context.Background(), key, value, ttl)
+}
+
+func (rc *RedisCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := rc.encode(value)
 	if err != nil {
 		return err
 	}
 	
+	return rc.setRaw(ctx, key, data, ttl)
+}
+
+// getRaw returns the encoded value of a key
+func (rc *RedisCache) getRaw(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := rc.withTimeout(ctx)
+	defer cancel()
+	
+	data, err := rc.client.Get(ctx, rc.key(key)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+	return data, err
+}
+
+// getRawWithTTL returns the encoded value of a key and its remaining TTL,
+// which is negative for keys that do not expire
+func (rc *RedisCache) getRawWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	ctx, cancel := rc.withTimeout(ctx)
+	defer cancel()
+	
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := rc.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, rc.key(key))
+		pttl = pipe.PTTL(ctx, rc.key(key))
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, 0, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	
+	data, err := get.Bytes()
+	return data, pttl.Val(), err
+}
+
+// setRaw stores an already encoded value
+func (rc *RedisCache) setRaw(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	ctx, cancel := rc.withTimeout(ctx)
+	defer cancel()
+	
 	return rc.client.Set(ctx, rc.key(key), data, ttl).Err()
 }
 
+func (rc *RedisCache) encode(value interface{}) ([]byte, error) {
+	return rc.codec.encode(value)
+}
+
 func (rc *RedisCache) Delete(key string) error {
-	ctx := context.Background()
+	return rc.DeleteCtx(context.Background(), key)
+}
+
+func (rc *RedisCache) DeleteCtx(ctx context.Context, key string) error {
+	ctx, cancel := rc.withTimeout(ctx)
+	defer cancel()
+	
 	return rc.client.Del(ctx, rc.key(key)).Err()
 }
 
+// Flush deletes the keys under this cache's prefix. Other data in the
+// Redis database, such as queues, is left alone.
 func (rc *RedisCache) Flush() error {
-	ctx := context.Background()
-	return rc.client.FlushDB(ctx).Err()
+	return rc.FlushCtx(context.Background())
 }
 
-func (rc *RedisCache) Remember(key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
-	// Try to get from cache first
-	err := rc.Get(key, dest)
-	if err == nil {
-		return nil
+// FlushCtx flushes like Flush. It scans the whole prefix, so only ctx
+// bounds it, not the operation timeout.
+func (rc *RedisCache) FlushCtx(ctx context.Context) error {
+	if rc.prefix == "" {
+		return fmt.Errorf("refusing to flush a Redis cache without a prefix")
 	}
 	
-	if err != ErrCacheMiss {
+	iter := rc.client.Scan(ctx, 0, escapePattern(rc.prefix)+":*", 500).Iterator()
+	
+	batch := make([]string, 0, 500)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			if err := rc.client.Unlink(ctx, batch...).Err(); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
 		return err
 	}
 	
-	// Cache miss, execute callback
-	value, err := callback()
-	if err != nil {
-		return err
+	if len(batch) > 0 {
+		return rc.client.Unlink(ctx, batch...).Err()
 	}
+	return nil
+}
+
+// Tags returns a view of the cache that records keys under the given tags
+func (rc *RedisCache) Tags(names ...string) *TaggedCache {
+	return newTaggedCache(rc, names)
+}
+
+func (rc *RedisCache) tagKey(tag string) string {
+	return rc.key("tag:" + tag + ":entries")
+}
+
+// tagScript adds a key to a tag set and keeps the set alive at least as
+// long as the key. A key without expiry makes the set persistent.
+var tagScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	redis.call('PERSIST', KEYS[1])
+else
+	local current = redis.call('PTTL', KEYS[1])
+	if existed == 0 or (current >= 0 and current < ttl) then
+		redis.call('PEXPIRE', KEYS[1], ttl)
+	end
+end
+return 1
+`)
+
+func (rc *RedisCache) tagKeys(ctx context.Context, tags []string, key string, ttl time.Duration) error {
+	ctx, cancel := rc.withTimeout(ctx)
+	defer cancel()
 	
-	// Store in cache
-	if err := rc.Set(key, value, ttl); err != nil {
-		return err
+	for _, tag := range tags {
+		if err := tagScript.Run(ctx, rc.client, []string{rc.tagKey(tag)}, rc.key(key), ttl.Milliseconds()).Err(); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+func (rc *RedisCache) flushTags(ctx context.Context, tags []string) error {
+	ctx, cancel := rc.withTimeout(ctx)
+	defer cancel()
 	
-	// Marshal and unmarshal to populate dest
-	data, err := json.Marshal(value)
+	for _, tag := range tags {
+		keys, err := rc.client.SMembers(ctx, rc.tagKey(tag)).Result()
+		if err != nil {
+			return err
+		}
+		
+		keys = append(keys, rc.tagKey(tag))
+		if err := rc.client.Unlink(ctx, keys...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add stores the value only if the key does not exist yet. It reports
+// whether the value was stored.
+func (rc *RedisCache) Add(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return rc.AddCtx(context.Background(), key, value, ttl)
+}
+
+func (rc *RedisCache) AddCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	data, err := rc.encode(value)
 	if err != nil {
+		return false, err
+	}
+	
+	ctx, cancel := rc.withTimeout(ctx)
+	defer cancel()
+	
+	return rc.client.SetNX(ctx, rc.key(key), data, ttl).Result()
+}
+
+// Increment atomically adds by to an integer value, creating it at zero
+// if it does not exist, and returns the new value
+func (rc *RedisCache) Increment(key string, by int64) (int64, error) {
+	return rc.IncrementCtx(context.Background(), key, by)
+}
+
+func (rc *RedisCache) IncrementCtx(ctx context.Context, key string, by int64) (int64, error) {
+	ctx, cancel := rc.withTimeout(ctx)
+	defer cancel()
+	
+	return rc.client.IncrBy(ctx, rc.key(key), by).Result()
+}
+
+// Decrement atomically subtracts by from an integer value and returns the
+// new value
+func (rc *RedisCache) Decrement(key string, by int64) (int64, error) {
+	return rc.IncrementCtx(context.Background(), key, -by)
+}
+
+func (rc *RedisCache) DecrementCtx(ctx context.Context, key string, by int64) (int64, error) {
+	return rc.IncrementCtx(ctx, key, -by)
+}
+
+// Pull gets a value and deletes it in one step
+func (rc *RedisCache) Pull(key string, dest interface{}) error {
+	return rc.PullCtx(context.Background(), key, dest)
+}
+
+func (rc *RedisCache) PullCtx(ctx context.Context, key string, dest interface{}) error {
+	ctx, cancel := rc.withTimeout(ctx)
+	defer cancel()
+	
+	data, err := rc.client.GetDel(ctx, rc.key(key)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return ErrCacheMiss
+		}
 		return err
 	}
 	
-	return json.Unmarshal(data, dest)
+	return decode(data, dest)
 }
 
-// MemoryCache implements in-memory caching
+// Forever stores a value without expiry
+func (rc *RedisCache) Forever(key string, value interface{}) error {
+	return rc.SetCtx(context.Background(), key, value, 0)
+}
+
+func (rc *RedisCache) ForeverCtx(ctx context.Context, key string, value interface{}) error {
+	return rc.SetCtx(ctx, key, value, 0)
+}
+
+// Close closes the underlying Redis client if the cache created it
+func (rc *RedisCache) Close() error {
+	if !rc.ownsClient {
+		return nil
+	}
+	return rc.client.Close()
+}
+
+// Remember returns the cached value, or runs the callback and caches its
+// result. Concurrent misses in this process share one callback run; see
+// SetRememberLock to coordinate between servers too.
+func (rc *RedisCache) Remember(key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return rc.RememberCtx(context.Background(), key, ttl, callback, dest)
+}
+
+func (rc *RedisCache) RememberCtx(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return remember(ctx, rc, &rc.group, key, ttl, rc.lockedLoad(ctx, key, callback), dest)
+}
+
+// Flexible caches the callback's result as fresh for the fresh duration,
+// then serves it stale for up to the stale duration while one caller
+// refreshes it in the background
+func (rc *RedisCache) Flexible(key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return rc.FlexibleCtx(context.Background(), key, fresh, stale, callback, dest)
+}
+
+func (rc *RedisCache) FlexibleCtx(ctx context.Context, key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return flexible(ctx, rc, &rc.group, rc.refreshLock, key, fresh, stale, callback, dest)
+}
+
+func (rc *RedisCache) flights() *flightGroup {
+	return &rc.group
+}
+
+// MemoryCacheConfig configures a MemoryCache. Zero values fall back to the
+// defaults noted on each field.
+type MemoryCacheConfig struct {
+	// MaxEntries bounds the number of keys; 0 means unbounded
+	MaxEntries int
+	// MaxBytes bounds the approximate size of keys and values; 0 means
+	// unbounded
+	MaxBytes int64
+	// DefaultTTL applies when Set is called with a zero ttl (default 24h).
+	// A negative value stores such keys without expiry.
+	DefaultTTL time.Duration
+	// CleanupInterval is how often expired keys are swept (default 5m)
+	CleanupInterval time.Duration
+}
+
+// CacheStats reports the activity of a MemoryCache
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// MemoryCache implements in-memory caching. Values are stored encoded with
+// the cache's serializer, and when the cache is bounded the least recently
+// used keys are evicted to make room.
 type MemoryCache struct {
-	data   map[string]cacheItem
-	mutex  sync.RWMutex
+	data   map[string]*list.Element
+	lru    *list.List
+	tags   map[string]map[string]struct{}
+	mutex  sync.Mutex
 	prefix string
+	group  flightGroup
+	config MemoryCacheConfig
+	stats  CacheStats
+	codec  codec
+	
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
 type cacheItem struct {
-	value     interface{}
+	key       string
+	data      []byte
 	expiresAt time.Time
+	pinned    bool
+}
+
+// entryOverhead approximates the bookkeeping bytes of one entry
+const entryOverhead = 64
+
+func (i *cacheItem) size() int64 {
+	return int64(len(i.key) + len(i.data) + entryOverhead)
 }
 
-// NewMemoryCache creates a new memory cache
+// expired reports whether the item has expired; a zero expiry never does
+func (i *cacheItem) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && now.After(i.expiresAt)
+}
+
+// expiry returns the expiry time for a ttl, where zero means never
+func expiry(ttl time.Duration) time.Time {
+	if ttl == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// NewMemoryCache creates a new unbounded memory cache
 func NewMemoryCache(prefix string) *MemoryCache {
+	return NewMemoryCacheWithConfig(prefix, MemoryCacheConfig{})
+}
+
+// NewMemoryCacheWithConfig creates a memory cache with the given limits.
+// Call Close to stop its cleanup goroutine.
+func NewMemoryCacheWithConfig(prefix string, config MemoryCacheConfig) *MemoryCache {
+	if config.DefaultTTL == 0 {
+		config.DefaultTTL = 24 * time.Hour
+	}
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = 5 * time.Minute
+	}
+	
 	mc := &MemoryCache{
-		data:   make(map[string]cacheItem),
+		data:   make(map[string]*list.Element),
+		lru:    list.New(),
+		tags:   make(map[string]map[string]struct{}),
 		prefix: prefix,
+		config: config,
+		stop:   make(chan struct{}),
 	}
 	
 	// Start cleanup goroutine
@@ -172,103 +556,406 @@ func (mc *MemoryCache) key(key string) string {
 	return key
 }
 
-func (mc *MemoryCache) Get(key string, dest interface{}) error {
-	mc.mutex.RLock()
-	defer mc.mutex.RUnlock()
+// ttlExpiry applies the default TTL to a zero ttl
+func (mc *MemoryCache) ttlExpiry(ttl time.Duration) time.Time {
+	if ttl == 0 {
+		ttl = mc.config.DefaultTTL
+	}
+	if ttl < 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// lookup returns a live item and marks it recently used. The caller must
+// hold the mutex.
+func (mc *MemoryCache) lookup(key string) (*cacheItem, bool) {
+	elem, exists := mc.data[key]
+	if !exists {
+		return nil, false
+	}
 	
-	item, exists := mc.data[mc.key(key)]
-	if !exists || time.Now().After(item.expiresAt) {
-		return ErrCacheMiss
+	item := elem.Value.(*cacheItem)
+	if item.expired(time.Now()) {
+		mc.remove(elem)
+		return nil, false
+	}
+	
+	mc.lru.MoveToFront(elem)
+	return item, true
+}
+
+// put stores an encoded value and evicts old keys if the cache is over
+// its limits. The caller must hold the mutex.
+func (mc *MemoryCache) put(key string, data []byte, expiresAt time.Time) {
+	if elem, exists := mc.data[key]; exists {
+		item := elem.Value.(*cacheItem)
+		mc.stats.Bytes -= item.size()
+		item.data = data
+		item.expiresAt = expiresAt
+		mc.stats.Bytes += item.size()
+		mc.lru.MoveToFront(elem)
+	} else {
+		item := &cacheItem{key: key, data: data, expiresAt: expiresAt}
+		mc.data[key] = mc.lru.PushFront(item)
+		mc.stats.Bytes += item.size()
 	}
 	
-	// Use JSON marshal/unmarshal for type conversion
-	data, err := json.Marshal(item.value)
+	// Evict from the least recently used end, sparing the key just
+	// written and held locks
+	for elem := mc.lru.Back(); elem != nil && mc.overLimit(); {
+		prev := elem.Prev()
+		if item := elem.Value.(*cacheItem); !item.pinned && item.key != key {
+			mc.remove(elem)
+			mc.stats.Evictions++
+		}
+		elem = prev
+	}
+}
+
+func (mc *MemoryCache) overLimit() bool {
+	return (mc.config.MaxEntries > 0 && mc.lru.Len() > mc.config.MaxEntries) ||
+		(mc.config.MaxBytes > 0 && mc.stats.Bytes > mc.config.MaxBytes)
+}
+
+// remove deletes an entry. The caller must hold the mutex.
+func (mc *MemoryCache) remove(elem *list.Element) {
+	item := elem.Value.(*cacheItem)
+	mc.lru.Remove(elem)
+	delete(mc.data, item.key)
+	mc.stats.Bytes -= item.size()
+}
+
+func (mc *MemoryCache) Get(key string, dest interface{}) error {
+	return mc.GetCtx(context.Background(), key, dest)
+}
+
+func (mc *MemoryCache) GetCtx(ctx context.Context, key string, dest interface{}) error {
+	data, err := mc.getRaw(ctx, key)
 	if err != nil {
 		return err
 	}
 	
-	return json.Unmarshal(data, dest)
+	return decode(data, dest)
 }
 
 func (mc *MemoryCache) Set(key string, value interface{}, ttl time.Duration) error {
-	mc.mutex.Lock()
-	defer mc.mutex.Unlock()
+	return mc.SetCtx(context.Background(), key, value, ttl)
+}
+
+func (mc *MemoryCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	
-	expiresAt := time.Now().Add(ttl)
-	if ttl == 0 {
-		expiresAt = time.Now().Add(24 * time.Hour) // Default 24 hours
+	data, err := mc.encode(value)
+	if err != nil {
+		return err
 	}
 	
-	mc.data[mc.key(key)] = cacheItem{
-		value:     value,
-		expiresAt: expiresAt,
+	return mc.setRaw(key, data, ttl)
+}
+
+// getRaw returns the encoded value of a key
+func (mc *MemoryCache) getRaw(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 	
-	return nil
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	
+	item, exists := mc.lookup(mc.key(key))
+	if !exists {
+		mc.stats.Misses++
+		return nil, ErrCacheMiss
+	}
+	mc.stats.Hits++
+	return item.data, nil
 }
 
-func (mc *MemoryCache) Delete(key string) error {
+// setRaw stores an already encoded value
+func (mc *MemoryCache) setRaw(key string, data []byte, ttl time.Duration) error {
 	mc.mutex.Lock()
 	defer mc.mutex.Unlock()
 	
-	delete(mc.data, mc.key(key))
+	mc.put(mc.key(key), data, mc.ttlExpiry(ttl))
 	return nil
 }
 
-func (mc *MemoryCache) Flush() error {
+func (mc *MemoryCache) encode(value interface{}) ([]byte, error) {
+	return mc.codec.encode(value)
+}
+
+// Add stores the value only if the key does not exist yet. It reports
+// whether the value was stored.
+func (mc *MemoryCache) Add(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return mc.AddCtx(context.Background(), key, value, ttl)
+}
+
+func (mc *MemoryCache) AddCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	
+	data, err := mc.encode(value)
+	if err != nil {
+		return false, err
+	}
+	
 	mc.mutex.Lock()
 	defer mc.mutex.Unlock()
 	
-	mc.data = make(map[string]cacheItem)
-	return nil
+	if _, exists := mc.lookup(mc.key(key)); exists {
+		return false, nil
+	}
+	
+	mc.put(mc.key(key), data, mc.ttlExpiry(ttl))
+	return true, nil
 }
 
-func (mc *MemoryCache) Remember(key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
-	// Try to get from cache first
-	err := mc.Get(key, dest)
-	if err == nil {
-		return nil
+// Increment atomically adds by to an integer value, creating it at zero
+// if it does not exist, and returns the new value
+func (mc *MemoryCache) Increment(key string, by int64) (int64, error) {
+	return mc.IncrementCtx(context.Background(), key, by)
+}
+
+func (mc *MemoryCache) IncrementCtx(ctx context.Context, key string, by int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	
+	var current int64
+	expiresAt := mc.ttlExpiry(0)
+	if item, exists := mc.lookup(mc.key(key)); exists {
+		value, err := strconv.ParseInt(string(item.data), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cache value for %s is not an integer", key)
+		}
+		current, expiresAt = value, item.expiresAt
 	}
 	
-	if err != ErrCacheMiss {
+	current += by
+	mc.put(mc.key(key), []byte(strconv.FormatInt(current, 10)), expiresAt)
+	return current, nil
+}
+
+// Decrement atomically subtracts by from an integer value and returns the
+// new value
+func (mc *MemoryCache) Decrement(key string, by int64) (int64, error) {
+	return mc.IncrementCtx(context.Background(), key, -by)
+}
+
+func (mc *MemoryCache) DecrementCtx(ctx context.Context, key string, by int64) (int64, error) {
+	return mc.IncrementCtx(ctx, key, -by)
+}
+
+// Pull gets a value and deletes it in one step
+func (mc *MemoryCache) Pull(key string, dest interface{}) error {
+	return mc.PullCtx(context.Background(), key, dest)
+}
+
+func (mc *MemoryCache) PullCtx(ctx context.Context, key string, dest interface{}) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 	
-	// Cache miss, execute callback
-	value, err := callback()
+	mc.mutex.Lock()
+	item, exists := mc.lookup(mc.key(key))
+	if !exists {
+		mc.stats.Misses++
+		mc.mutex.Unlock()
+		return ErrCacheMiss
+	}
+	mc.stats.Hits++
+	mc.remove(mc.data[item.key])
+	mc.mutex.Unlock()
+	
+	return decode(item.data, dest)
+}
+
+// Forever stores a value without expiry
+func (mc *MemoryCache) Forever(key string, value interface{}) error {
+	return mc.ForeverCtx(context.Background(), key, value)
+}
+
+func (mc *MemoryCache) ForeverCtx(ctx context.Context, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	data, err := mc.encode(value)
 	if err != nil {
 		return err
 	}
 	
-	// Store in cache
-	if err := mc.Set(key, value, ttl); err != nil {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	
+	mc.put(mc.key(key), data, time.Time{})
+	return nil
+}
+
+func (mc *MemoryCache) Delete(key string) error {
+	return mc.DeleteCtx(context.Background(), key)
+}
+
+func (mc *MemoryCache) DeleteCtx(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 	
-	// Marshal and unmarshal to populate dest
-	data, err := json.Marshal(value)
-	if err != nil {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	
+	if elem, exists := mc.data[mc.key(key)]; exists {
+		mc.remove(elem)
+	}
+	return nil
+}
+
+func (mc *MemoryCache) Flush() error {
+	return mc.FlushCtx(context.Background())
+}
+
+func (mc *MemoryCache) FlushCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 	
-	return json.Unmarshal(data, dest)
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	
+	mc.data = make(map[string]*list.Element)
+	mc.lru.Init()
+	mc.tags = make(map[string]map[string]struct{})
+	mc.stats.Bytes = 0
+	return nil
+}
+
+// Stats returns hit, miss and eviction counts and the current size
+func (mc *MemoryCache) Stats() CacheStats {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	
+	stats := mc.stats
+	stats.Entries = mc.lru.Len()
+	return stats
+}
+
+// Close stops the cleanup goroutine
+func (mc *MemoryCache) Close() error {
+	mc.closeOnce.Do(func() {
+		close(mc.stop)
+	})
+	return nil
+}
+
+// Tags returns a view of the cache that records keys under the given tags
+func (mc *MemoryCache) Tags(names ...string) *TaggedCache {
+	return newTaggedCache(mc, names)
+}
+
+func (mc *MemoryCache) tagKeys(ctx context.Context, tags []string, key string, ttl time.Duration) error {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	
+	for _, tag := range tags {
+		if mc.tags[tag] == nil {
+			mc.tags[tag] = make(map[string]struct{})
+		}
+		mc.tags[tag][mc.key(key)] = struct{}{}
+	}
+	return nil
+}
+
+func (mc *MemoryCache) flushTags(ctx context.Context, tags []string) error {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	
+	for _, tag := range tags {
+		for key := range mc.tags[tag] {
+			if elem, exists := mc.data[key]; exists {
+				mc.remove(elem)
+			}
+		}
+		delete(mc.tags, tag)
+	}
+	return nil
+}
+
+// Remember returns the cached value, or runs the callback and caches its
+// result. Concurrent misses share one callback run.
+func (mc *MemoryCache) Remember(key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return mc.RememberCtx(context.Background(), key, ttl, callback, dest)
+}
+
+func (mc *MemoryCache) RememberCtx(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return remember(ctx, mc, &mc.group, key, ttl, callback, dest)
+}
+
+// Flexible caches the callback's result as fresh for the fresh duration,
+// then serves it stale for up to the stale duration while one caller
+// refreshes it in the background
+func (mc *MemoryCache) Flexible(key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return mc.FlexibleCtx(context.Background(), key, fresh, stale, callback, dest)
+}
+
+func (mc *MemoryCache) FlexibleCtx(ctx context.Context, key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return flexible(ctx, mc, &mc.group, mc.refreshLock, key, fresh, stale, callback, dest)
+}
+
+func (mc *MemoryCache) flights() *flightGroup {
+	return &mc.group
 }
 
 func (mc *MemoryCache) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(mc.config.CleanupInterval)
 	defer ticker.Stop()
 	
-	for range ticker.C {
+	for {
+		select {
+		case <-mc.stop:
+			return
+		case <-ticker.C:
+		}
+		
 		mc.mutex.Lock()
 		now := time.Now()
-		for key, item := range mc.data {
-			if now.After(item.expiresAt) {
-				delete(mc.data, key)
+		for _, elem := range mc.data {
+			if elem.Value.(*cacheItem).expired(now) {
+				mc.remove(elem)
+			}
+		}
+		for tag, keys := range mc.tags {
+			for key := range keys {
+				if _, exists := mc.data[key]; !exists {
+					delete(keys, key)
+				}
+			}
+			if len(keys) == 0 {
+				delete(mc.tags, tag)
 			}
 		}
 		mc.mutex.Unlock()
 	}
 }
 
+// escapePattern escapes glob characters for a Redis SCAN MATCH pattern
+func escapePattern(s string) string {
+	var escaped []rune
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, r)
+	}
+	return string(escaped)
+}
+
 // ErrCacheMiss indicates cache miss
 var ErrCacheMiss = fmt.Errorf("cache miss")
\ No newline at end of file
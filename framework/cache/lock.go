@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Lock is a named lock held in a cache store. Each lock has an owner token
+// so only the holder can release it; a lock acquired in one process can be
+// released in another with RestoreLock and the same owner.
+type Lock interface {
+	// Get tries to acquire the lock once
+	Get() (bool, error)
+	// Block waits up to timeout for the lock, returning ErrLockTimeout if
+	// it could not be acquired
+	Block(timeout time.Duration) error
+	// Release releases the lock if this owner still holds it
+	Release() (bool, error)
+	// ForceRelease releases the lock regardless of its owner
+	ForceRelease() error
+	// Owner returns the owner token
+	Owner() string
+}
+
+// ErrLockTimeout indicates Block gave up waiting for a lock
+var ErrLockTimeout = fmt.Errorf("timed out waiting for cache lock")
+
+// lockRetryInterval is how often Block retries a held lock
+const lockRetryInterval = 100 * time.Millisecond
+
+// lockStore is implemented by stores that back CacheLock
+type lockStore interface {
+	acquireLock(name, owner string, ttl time.Duration) (bool, error)
+	releaseLock(name, owner string) (bool, error)
+	forceReleaseLock(name string) error
+}
+
+// CacheLock implements Lock on top of a cache store
+type CacheLock struct {
+	store lockStore
+	name  string
+	owner string
+	ttl   time.Duration
+}
+
+func newCacheLock(store lockStore, name, owner string, ttl time.Duration) *CacheLock {
+	if owner == "" {
+		owner = uuid.NewString()
+	}
+	return &CacheLock{
+		store: store,
+		name:  name,
+		owner: owner,
+		ttl:   ttl,
+	}
+}
+
+func (l *CacheLock) Get() (bool, error) {
+	return l.store.acquireLock(l.name, l.owner, l.ttl)
+}
+
+func (l *CacheLock) Block(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		acquired, err := l.Get()
+		if err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+		if time.Now().Add(lockRetryInterval).After(deadline) {
+			return ErrLockTimeout
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func (l *CacheLock) Release() (bool, error) {
+	return l.store.releaseLock(l.name, l.owner)
+}
+
+func (l *CacheLock) ForceRelease() error {
+	return l.store.forceReleaseLock(l.name)
+}
+
+func (l *CacheLock) Owner() string {
+	return l.owner
+}
+
+// Lock returns a lock with a fresh owner token. A zero ttl never expires.
+func (rc *RedisCache) Lock(name string, ttl time.Duration) Lock {
+	return newCacheLock(rc, name, "", ttl)
+}
+
+// RestoreLock returns a handle on a lock held by the given owner
+func (rc *RedisCache) RestoreLock(name, owner string) Lock {
+	return newCacheLock(rc, name, owner, 0)
+}
+
+// releaseLockScript deletes a lock only if it still holds our token
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (rc *RedisCache) lockKey(name string) string {
+	return rc.key("lock:" + name)
+}
+
+func (rc *RedisCache) acquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := rc.withTimeout(context.Background())
+	defer cancel()
+	return rc.client.SetNX(ctx, rc.lockKey(name), owner, ttl).Result()
+}
+
+func (rc *RedisCache) releaseLock(name, owner string) (bool, error) {
+	ctx, cancel := rc.withTimeout(context.Background())
+	defer cancel()
+	deleted, err := releaseLockScript.Run(ctx, rc.client, []string{rc.lockKey(name)}, owner).Int64()
+	return deleted == 1, err
+}
+
+func (rc *RedisCache) forceReleaseLock(name string) error {
+	ctx, cancel := rc.withTimeout(context.Background())
+	defer cancel()
+	return rc.client.Del(ctx, rc.lockKey(name)).Err()
+}
+
+// Lock returns a lock with a fresh owner token. A zero ttl never expires.
+func (mc *MemoryCache) Lock(name string, ttl time.Duration) Lock {
+	return newCacheLock(mc, name, "", ttl)
+}
+
+// RestoreLock returns a handle on a lock held by the given owner
+func (mc *MemoryCache) RestoreLock(name, owner string) Lock {
+	return newCacheLock(mc, name, owner, 0)
+}
+
+func (mc *MemoryCache) acquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	key := mc.key("lock:" + name)
+	if _, exists := mc.lookup(key); exists {
+		return false, nil
+	}
+
+	// Held locks are never evicted to make room
+	mc.put(key, []byte(owner), expiry(ttl))
+	mc.data[key].Value.(*cacheItem).pinned = true
+	return true, nil
+}
+
+func (mc *MemoryCache) releaseLock(name, owner string) (bool, error) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	key := mc.key("lock:" + name)
+	item, exists := mc.lookup(key)
+	if !exists || string(item.data) != owner {
+		return false, nil
+	}
+
+	mc.remove(mc.data[key])
+	return true, nil
+}
+
+func (mc *MemoryCache) forceReleaseLock(name string) error {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if elem, exists := mc.data[mc.key("lock:"+name)]; exists {
+		mc.remove(elem)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// flightGroup coalesces concurrent loads of the same key, so only one
+// caller runs the callback and the others share its result
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// do runs fn once for all concurrent callers with the same key
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, exists := g.calls[key]; exists {
+		g.mutex.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mutex.Unlock()
+
+	call.value, call.err = fn()
+	call.wg.Done()
+
+	g.mutex.Lock()
+	delete(g.calls, key)
+	g.mutex.Unlock()
+
+	return call.value, call.err
+}
+
+// doAsync starts fn in the background unless a call for key is running
+func (g *flightGroup) doAsync(key string, fn func() error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if _, exists := g.calls[key]; exists {
+		g.mutex.Unlock()
+		return
+	}
+
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mutex.Unlock()
+
+	go func() {
+		call.err = fn()
+		call.wg.Done()
+
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+	}()
+}
+
+// storedValue is a value already encoded by the store. Stores write it
+// as is, and each caller decodes its own copy.
+type storedValue []byte
+
+// valueStore is a Cache that exposes its encoded values
+type valueStore interface {
+	Cache
+	getRaw(ctx context.Context, key string) ([]byte, error)
+	encode(value interface{}) ([]byte, error)
+}
+
+// remember returns the cached value for key, or loads and stores it.
+// Concurrent misses in this process share a single load, which runs with
+// the first caller's context.
+func remember(ctx context.Context, store valueStore, group *flightGroup, key string, ttl time.Duration, load func() (interface{}, error), dest interface{}) error {
+	err := store.GetCtx(ctx, key, dest)
+	if err != ErrCacheMiss {
+		return err
+	}
+
+	value, err := group.do(key, func() (interface{}, error) {
+		// The key may have been filled while this caller waited
+		if data, err := store.getRaw(ctx, key); err != ErrCacheMiss {
+			return storedValue(data), err
+		}
+
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+		if stored, ok := value.(storedValue); ok {
+			return stored, nil
+		}
+
+		data, err := store.encode(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.SetCtx(ctx, key, storedValue(data), ttl); err != nil {
+			return nil, err
+		}
+		return storedValue(data), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return assign(value, dest)
+}
+
+// flexibleEntry is how Flexible stores a value, encoded by the store,
+// alongside its freshness. Entries from before values were encoded by the
+// store have no Data and are reloaded.
+type flexibleEntry struct {
+	Data       []byte    `json:"data"`
+	FreshUntil time.Time `json:"fresh_until"`
+}
+
+// flexible serves a value that is fresh for the fresh duration and then
+// stale for the stale duration. A stale read returns the old value at once
+// and refreshes it in the background; only a full miss waits for load.
+// Background refreshes outlive the request, so they do not use ctx.
+func flexible(ctx context.Context, store valueStore, group *flightGroup, lock func(key string) (func(), bool), key string, fresh, stale time.Duration, load func() (interface{}, error), dest interface{}) error {
+	refresh := func(ctx context.Context) (interface{}, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := store.encode(value)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := flexibleEntry{Data: data, FreshUntil: time.Now().Add(fresh)}
+		if err := store.SetCtx(ctx, key, entry, fresh+stale); err != nil {
+			return nil, err
+		}
+		return storedValue(data), nil
+	}
+
+	var entry flexibleEntry
+	err := store.GetCtx(ctx, key, &entry)
+	if err == ErrCacheMiss || (err == nil && entry.Data == nil) {
+		value, err := group.do(key, func() (interface{}, error) {
+			return refresh(ctx)
+		})
+		if err != nil {
+			return err
+		}
+		return assign(value, dest)
+	}
+	if err != nil {
+		return err
+	}
+
+	if time.Now().After(entry.FreshUntil) {
+		group.doAsync("refresh:"+key, func() error {
+			release, acquired := lock(key)
+			if !acquired {
+				return nil
+			}
+			defer release()
+
+			if _, err := refresh(context.Background()); err != nil {
+				log.Printf("Cache refresh for %s failed: %v", key, err)
+				return err
+			}
+			return nil
+		})
+	}
+
+	return decode(entry.Data, dest)
+}
+
+// assign decodes a loaded value into dest
+func assign(value interface{}, dest interface{}) error {
+	return decode(value.(storedValue), dest)
+}
+
+// holdLock takes the named lock and returns a func that releases it
+func holdLock(lock Lock) (func(), bool, error) {
+	acquired, err := lock.Get()
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+
+	release := func() {
+		if _, err := lock.Release(); err != nil {
+			log.Printf("Failed to release cache lock: %v", err)
+		}
+	}
+	return release, true, nil
+}
+
+// SetRememberLock makes Remember take a Redis lock before loading a missing
+// key, so only one server runs the callback. Other servers poll for the
+// value for up to wait before loading it themselves. A zero ttl disables
+// the lock.
+func (rc *RedisCache) SetRememberLock(ttl, wait time.Duration) {
+	rc.lockTTL = ttl
+	rc.lockWait = wait
+}
+
+// lockedLoad wraps a Remember callback in the distributed lock, if enabled
+func (rc *RedisCache) lockedLoad(ctx context.Context, key string, callback func() (interface{}, error)) func() (interface{}, error) {
+	if rc.lockTTL <= 0 {
+		return callback
+	}
+
+	return func() (interface{}, error) {
+		release, acquired, err := holdLock(rc.Lock(key, rc.lockTTL))
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			defer release()
+			return callback()
+		}
+
+		// Another server is loading the value; wait for it to appear
+		deadline := time.Now().Add(rc.lockWait)
+		for time.Now().Before(deadline) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			data, err := rc.getRaw(ctx, key)
+			if err == nil {
+				return storedValue(data), nil
+			}
+			if err != ErrCacheMiss {
+				return nil, err
+			}
+		}
+		return callback()
+	}
+}
+
+// refreshLock keeps other servers from refreshing a Flexible key at the
+// same time
+func (rc *RedisCache) refreshLock(key string) (func(), bool) {
+	release, acquired, err := holdLock(rc.Lock("refresh:"+key, time.Minute))
+	if err != nil {
+		log.Printf("Failed to lock cache refresh for %s: %v", key, err)
+		return nil, false
+	}
+	return release, acquired
+}
+
+// refreshLock always succeeds; doAsync already prevents concurrent
+// refreshes within the process
+func (mc *MemoryCache) refreshLock(key string) (func(), bool) {
+	return func() {}, true
+}
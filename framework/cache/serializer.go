@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Serializer encodes values for a cache store. Each serializer has a format
+// byte that is recorded in the stored value, so a store can still read
+// values written with a different serializer after it is switched.
+type Serializer interface {
+	// Format identifies the serializer in stored values
+	Format() byte
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(data []byte, dest interface{}) error
+}
+
+// Built-in serializer formats
+const (
+	FormatJSON    byte = 'j'
+	FormatGob     byte = 'g'
+	FormatMsgpack byte = 'm'
+)
+
+// JSONSerializer stores values as JSON. It is the default, and its
+// uncompressed values are plain JSON that older releases can read.
+type JSONSerializer struct{}
+
+func (JSONSerializer) Format() byte { return FormatJSON }
+
+func (JSONSerializer) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONSerializer) Unmarshal(data []byte, dest interface{}) error {
+	return json.Unmarshal(data, dest)
+}
+
+// GobSerializer stores values with encoding/gob, which keeps Go types
+// intact. Concrete types held in interface values must be registered with
+// gob.Register.
+type GobSerializer struct{}
+
+func (GobSerializer) Format() byte { return FormatGob }
+
+func (GobSerializer) Marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobSerializer) Unmarshal(data []byte, dest interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dest)
+}
+
+// MsgpackSerializer stores values in MessagePack, which is more compact
+// than JSON and keeps integers and binary data intact. Structs are written
+// as maps keyed by field name, honouring `msgpack` and then `json` tags.
+// Times use the standard timestamp extension, so they come back as the
+// same instant in the local zone.
+type MsgpackSerializer struct{}
+
+func (MsgpackSerializer) Format() byte { return FormatMsgpack }
+
+func (MsgpackSerializer) Marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes into dest; integers held in interface values decode
+// to int64 or uint64
+func (MsgpackSerializer) Unmarshal(data []byte, dest interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	dec.UseLooseInterfaceDecoding(true)
+	return dec.Decode(dest)
+}
+
+var (
+	serializersMutex sync.RWMutex
+	serializers      = map[byte]Serializer{
+		FormatJSON:    JSONSerializer{},
+		FormatGob:     GobSerializer{},
+		FormatMsgpack: MsgpackSerializer{},
+	}
+)
+
+// ErrFormatTaken is returned when a serializer's format byte is already
+// used by a serializer of another type
+var ErrFormatTaken = fmt.Errorf("cache value format is taken")
+
+// RegisterSerializer makes a custom serializer's values readable by every
+// store. Stores register the serializer passed to SetSerializer themselves.
+// A format can only be registered again by a serializer of the same type,
+// so the built-in formats cannot be overridden.
+func RegisterSerializer(s Serializer) error {
+	serializersMutex.Lock()
+	defer serializersMutex.Unlock()
+
+	format := s.Format()
+	if existing, ok := serializers[format]; ok && reflect.TypeOf(existing) != reflect.TypeOf(s) {
+		return fmt.Errorf("%w: %q is used by %T", ErrFormatTaken, format, existing)
+	}
+	serializers[format] = s
+	return nil
+}
+
+func serializerFor(format byte) (Serializer, error) {
+	serializersMutex.RLock()
+	defer serializersMutex.RUnlock()
+
+	s, ok := serializers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown cache value format %q", format)
+	}
+	return s, nil
+}
+
+// Stored values start with a header of valueMagic, the serializer format
+// and flags. valueMagic can never start a JSON document, so values without
+// it are read as plain JSON.
+const (
+	valueMagic byte = 0xC1
+	headerSize      = 3
+	flagGzip   byte = 1 << 0
+)
+
+// codec encodes values with a store's serializer and compression settings.
+// The zero codec writes plain JSON.
+type codec struct {
+	serializer    Serializer
+	compressAbove int
+}
+
+// encode serializes a value. Integers are always stored as plain decimals
+// so Increment keeps working on them; plain JSON is stored without a header.
+func (c codec) encode(value interface{}) ([]byte, error) {
+	if stored, ok := value.(storedValue); ok {
+		return stored, nil
+	}
+	if digits, ok := integerValue(value); ok {
+		return digits, nil
+	}
+
+	serializer := c.serializer
+	if serializer == nil {
+		serializer = JSONSerializer{}
+	}
+
+	data, err := serializer.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags byte
+	if c.compressAbove > 0 && len(data) > c.compressAbove {
+		if compressed, err := gzipBytes(data); err == nil && len(compressed) < len(data) {
+			data, flags = compressed, flagGzip
+		}
+	}
+
+	format := serializer.Format()
+	if format == FormatJSON && flags == 0 {
+		return data, nil
+	}
+
+	return append([]byte{valueMagic, format, flags}, data...), nil
+}
+
+// decode reads a stored value using the format recorded in its header
+func decode(data []byte, dest interface{}) error {
+	if len(data) < headerSize || data[0] != valueMagic {
+		return json.Unmarshal(data, dest)
+	}
+
+	serializer, err := serializerFor(data[1])
+	if err != nil {
+		return err
+	}
+
+	flags, body := data[2], data[headerSize:]
+	if flags&flagGzip != 0 {
+		if body, err = gunzipBytes(body); err != nil {
+			return fmt.Errorf("decompress cache value: %w", err)
+		}
+	}
+
+	return serializer.Unmarshal(body, dest)
+}
+
+func integerValue(value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10), true
+	case int8:
+		return strconv.AppendInt(nil, int64(v), 10), true
+	case int16:
+		return strconv.AppendInt(nil, int64(v), 10), true
+	case int32:
+		return strconv.AppendInt(nil, int64(v), 10), true
+	case int64:
+		return strconv.AppendInt(nil, v, 10), true
+	case uint:
+		return strconv.AppendUint(nil, uint64(v), 10), true
+	case uint8:
+		return strconv.AppendUint(nil, uint64(v), 10), true
+	case uint16:
+		return strconv.AppendUint(nil, uint64(v), 10), true
+	case uint32:
+		return strconv.AppendUint(nil, uint64(v), 10), true
+	case uint64:
+		return strconv.AppendUint(nil, v, 10), true
+	}
+	return nil, false
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// SetSerializer sets the serializer for values written from now on.
+// Values already stored keep their format and stay readable.
+func (rc *RedisCache) SetSerializer(s Serializer) error {
+	if err := RegisterSerializer(s); err != nil {
+		return err
+	}
+	rc.codec.serializer = s
+	return nil
+}
+
+// SetCompression gzips encoded values larger than threshold bytes. Zero
+// disables compression.
+func (rc *RedisCache) SetCompression(threshold int) {
+	rc.codec.compressAbove = threshold
+}
+
+// SetSerializer sets the serializer for values written from now on.
+// Values already stored keep their format and stay readable.
+func (mc *MemoryCache) SetSerializer(s Serializer) error {
+	if err := RegisterSerializer(s); err != nil {
+		return err
+	}
+	mc.codec.serializer = s
+	return nil
+}
+
+// SetCompression gzips encoded values larger than threshold bytes. Zero
+// disables compression.
+func (mc *MemoryCache) SetCompression(threshold int) {
+	mc.codec.compressAbove = threshold
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// TaggedCache writes keys to a store and remembers them under a set of
+// tags, so everything stored under a tag can be flushed at once:
+//
+//	store.Tags("users", "team:5").Set("user:1", user, time.Hour)
+//	store.Tags("users").Flush()
+//
+// Keys are not namespaced by their tags; reading a key works through any
+// tag set, or the store itself.
+type TaggedCache struct {
+	store tagStore
+	tags  []string
+}
+
+// tagStore is implemented by stores that can track keys per tag
+type tagStore interface {
+	valueStore
+	tagKeys(ctx context.Context, tags []string, key string, ttl time.Duration) error
+	flushTags(ctx context.Context, tags []string) error
+	flights() *flightGroup
+	refreshLock(key string) (func(), bool)
+}
+
+func newTaggedCache(store tagStore, tags []string) *TaggedCache {
+	return &TaggedCache{
+		store: store,
+		tags:  append([]string(nil), tags...),
+	}
+}
+
+// Tags returns a tagged cache using these tags and the current ones
+func (tc *TaggedCache) Tags(names ...string) *TaggedCache {
+	return newTaggedCache(tc.store, append(append([]string(nil), tc.tags...), names...))
+}
+
+// GetTags returns the tags keys are stored under
+func (tc *TaggedCache) GetTags() []string {
+	return append([]string(nil), tc.tags...)
+}
+
+func (tc *TaggedCache) Get(key string, dest interface{}) error {
+	return tc.store.Get(key, dest)
+}
+
+func (tc *TaggedCache) GetCtx(ctx context.Context, key string, dest interface{}) error {
+	return tc.store.GetCtx(ctx, key, dest)
+}
+
+func (tc *TaggedCache) getRaw(ctx context.Context, key string) ([]byte, error) {
+	return tc.store.getRaw(ctx, key)
+}
+
+func (tc *TaggedCache) encode(value interface{}) ([]byte, error) {
+	return tc.store.encode(value)
+}
+
+func (tc *TaggedCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return tc.SetCtx(context.Background(), key, value, ttl)
+}
+
+func (tc *TaggedCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := tc.store.SetCtx(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	return tc.store.tagKeys(ctx, tc.tags, key, ttl)
+}
+
+func (tc *TaggedCache) Delete(key string) error {
+	return tc.store.Delete(key)
+}
+
+func (tc *TaggedCache) DeleteCtx(ctx context.Context, key string) error {
+	return tc.store.DeleteCtx(ctx, key)
+}
+
+func (tc *TaggedCache) Add(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return tc.AddCtx(context.Background(), key, value, ttl)
+}
+
+func (tc *TaggedCache) AddCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	added, err := tc.store.AddCtx(ctx, key, value, ttl)
+	if err != nil || !added {
+		return added, err
+	}
+	return true, tc.store.tagKeys(ctx, tc.tags, key, ttl)
+}
+
+func (tc *TaggedCache) Increment(key string, by int64) (int64, error) {
+	return tc.IncrementCtx(context.Background(), key, by)
+}
+
+func (tc *TaggedCache) IncrementCtx(ctx context.Context, key string, by int64) (int64, error) {
+	value, err := tc.store.IncrementCtx(ctx, key, by)
+	if err != nil {
+		return 0, err
+	}
+	return value, tc.store.tagKeys(ctx, tc.tags, key, 0)
+}
+
+func (tc *TaggedCache) Decrement(key string, by int64) (int64, error) {
+	return tc.IncrementCtx(context.Background(), key, -by)
+}
+
+func (tc *TaggedCache) DecrementCtx(ctx context.Context, key string, by int64) (int64, error) {
+	return tc.IncrementCtx(ctx, key, -by)
+}
+
+func (tc *TaggedCache) Pull(key string, dest interface{}) error {
+	return tc.store.Pull(key, dest)
+}
+
+func (tc *TaggedCache) PullCtx(ctx context.Context, key string, dest interface{}) error {
+	return tc.store.PullCtx(ctx, key, dest)
+}
+
+func (tc *TaggedCache) Forever(key string, value interface{}) error {
+	return tc.ForeverCtx(context.Background(), key, value)
+}
+
+func (tc *TaggedCache) ForeverCtx(ctx context.Context, key string, value interface{}) error {
+	if err := tc.store.ForeverCtx(ctx, key, value); err != nil {
+		return err
+	}
+	return tc.store.tagKeys(ctx, tc.tags, key, 0)
+}
+
+// Lock returns a lock from the underlying store; locks are not tagged
+func (tc *TaggedCache) Lock(name string, ttl time.Duration) Lock {
+	return tc.store.Lock(name, ttl)
+}
+
+func (tc *TaggedCache) RestoreLock(name, owner string) Lock {
+	return tc.store.RestoreLock(name, owner)
+}
+
+// Flush deletes every key stored under any of the tags
+func (tc *TaggedCache) Flush() error {
+	return tc.FlushCtx(context.Background())
+}
+
+func (tc *TaggedCache) FlushCtx(ctx context.Context) error {
+	return tc.store.flushTags(ctx, tc.tags)
+}
+
+func (tc *TaggedCache) Remember(key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return tc.RememberCtx(context.Background(), key, ttl, callback, dest)
+}
+
+func (tc *TaggedCache) RememberCtx(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return remember(ctx, tc, tc.store.flights(), key, ttl, callback, dest)
+}
+
+func (tc *TaggedCache) Flexible(key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return tc.FlexibleCtx(context.Background(), key, fresh, stale, callback, dest)
+}
+
+func (tc *TaggedCache) FlexibleCtx(ctx context.Context, key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return flexible(ctx, tc, tc.store.flights(), tc.store.refreshLock, key, fresh, stale, callback, dest)
+}
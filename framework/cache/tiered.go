@@ -0,0 +1,351 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// TieredCacheConfig configures a TieredCache
+type TieredCacheConfig struct {
+	// Channel is the Redis pub/sub channel for invalidations (default
+	// "cache:invalidate")
+	Channel string
+	// LocalTTL caps how long a value stays in the local tier, bounding
+	// staleness if an invalidation is missed (default 1m)
+	LocalTTL time.Duration
+}
+
+// TieredCache reads through a local MemoryCache in front of a shared
+// RedisCache. Writes go to Redis and publish an invalidation so every
+// other instance drops its local copy of the key.
+type TieredCache struct {
+	local    *MemoryCache
+	remote   *RedisCache
+	channel  string
+	localTTL time.Duration
+	origin   string
+	group    flightGroup
+
+	// generation counts changes to the local tier, so a read that raced
+	// an invalidation does not put back the stale value
+	mutex      sync.Mutex
+	generation uint64
+
+	pubsub *redis.PubSub
+	done   chan struct{}
+}
+
+// invalidation is the message published when keys change
+type invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys,omitempty"`
+	Flush  bool     `json:"flush,omitempty"`
+}
+
+// NewTieredCache creates a tiered cache and subscribes to invalidations.
+// The local store should be dedicated to this cache; the remote store may
+// be shared.
+func NewTieredCache(local *MemoryCache, remote *RedisCache, config TieredCacheConfig) *TieredCache {
+	if config.Channel == "" {
+		config.Channel = "cache:invalidate"
+	}
+	if config.LocalTTL <= 0 {
+		config.LocalTTL = time.Minute
+	}
+
+	tc := &TieredCache{
+		local:    local,
+		remote:   remote,
+		channel:  config.Channel,
+		localTTL: config.LocalTTL,
+		origin:   uuid.NewString(),
+		pubsub:   remote.client.Subscribe(context.Background(), config.Channel),
+		done:     make(chan struct{}),
+	}
+
+	go tc.listen()
+
+	return tc
+}
+
+// listen applies invalidations published by other instances
+func (tc *TieredCache) listen() {
+	defer close(tc.done)
+
+	for msg := range tc.pubsub.Channel() {
+		var inv invalidation
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+			log.Printf("Invalid cache invalidation message: %v", err)
+			continue
+		}
+		if inv.Origin == tc.origin {
+			continue
+		}
+
+		if inv.Flush {
+			tc.flushLocal()
+			continue
+		}
+		tc.dropLocal(inv.Keys...)
+	}
+}
+
+// dropLocal deletes keys from the local tier
+func (tc *TieredCache) dropLocal(keys ...string) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	tc.generation++
+	for _, key := range keys {
+		tc.local.Delete(key)
+	}
+}
+
+// flushLocal empties the local tier
+func (tc *TieredCache) flushLocal() {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	tc.generation++
+	tc.local.Flush()
+}
+
+// invalidate drops keys locally and tells the other instances to do so
+func (tc *TieredCache) invalidate(ctx context.Context, keys ...string) error {
+	tc.dropLocal(keys...)
+	return tc.publish(ctx, invalidation{Origin: tc.origin, Keys: keys})
+}
+
+func (tc *TieredCache) publish(ctx context.Context, inv invalidation) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := tc.remote.withTimeout(ctx)
+	defer cancel()
+	return tc.remote.client.Publish(ctx, tc.channel, data).Err()
+}
+
+// localExpiry caps a ttl at the local tier's TTL
+func (tc *TieredCache) localExpiry(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > tc.localTTL {
+		return tc.localTTL
+	}
+	return ttl
+}
+
+func (tc *TieredCache) Get(key string, dest interface{}) error {
+	return tc.GetCtx(context.Background(), key, dest)
+}
+
+func (tc *TieredCache) GetCtx(ctx context.Context, key string, dest interface{}) error {
+	data, err := tc.getRaw(ctx, key)
+	if err != nil {
+		return err
+	}
+	return decode(data, dest)
+}
+
+// getRaw reads the local tier, then Redis, keeping a local copy of what it
+// finds for no longer than Redis keeps the key. The copy is not kept if
+// the key was invalidated while Redis was read.
+func (tc *TieredCache) getRaw(ctx context.Context, key string) ([]byte, error) {
+	data, err := tc.local.getRaw(ctx, key)
+	if err != ErrCacheMiss {
+		return data, err
+	}
+
+	tc.mutex.Lock()
+	generation := tc.generation
+	tc.mutex.Unlock()
+
+	data, ttl, err := tc.remote.getRawWithTTL(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.generation != generation {
+		return data, nil
+	}
+	if err := tc.local.setRaw(key, data, tc.localExpiry(ttl)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// encode encodes values as Redis does, so both tiers hold the same bytes
+func (tc *TieredCache) encode(value interface{}) ([]byte, error) {
+	return tc.remote.encode(value)
+}
+
+// SetSerializer sets the serializer for values written from now on
+func (tc *TieredCache) SetSerializer(s Serializer) error {
+	return tc.remote.SetSerializer(s)
+}
+
+// SetCompression gzips encoded values larger than threshold bytes. Zero
+// disables compression.
+func (tc *TieredCache) SetCompression(threshold int) {
+	tc.remote.SetCompression(threshold)
+}
+
+func (tc *TieredCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return tc.SetCtx(context.Background(), key, value, ttl)
+}
+
+func (tc *TieredCache) SetCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := tc.encode(value)
+	if err != nil {
+		return err
+	}
+	if err := tc.remote.setRaw(ctx, key, data, ttl); err != nil {
+		return err
+	}
+	if err := tc.invalidate(ctx, key); err != nil {
+		return err
+	}
+	return tc.local.setRaw(key, data, tc.localExpiry(ttl))
+}
+
+func (tc *TieredCache) Delete(key string) error {
+	return tc.DeleteCtx(context.Background(), key)
+}
+
+func (tc *TieredCache) DeleteCtx(ctx context.Context, key string) error {
+	if err := tc.remote.DeleteCtx(ctx, key); err != nil {
+		return err
+	}
+	return tc.invalidate(ctx, key)
+}
+
+// Flush flushes Redis under its prefix and the local tier of every instance
+func (tc *TieredCache) Flush() error {
+	return tc.FlushCtx(context.Background())
+}
+
+func (tc *TieredCache) FlushCtx(ctx context.Context) error {
+	if err := tc.remote.FlushCtx(ctx); err != nil {
+		return err
+	}
+	tc.flushLocal()
+	return tc.publish(ctx, invalidation{Origin: tc.origin, Flush: true})
+}
+
+func (tc *TieredCache) Add(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return tc.AddCtx(context.Background(), key, value, ttl)
+}
+
+func (tc *TieredCache) AddCtx(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	added, err := tc.remote.AddCtx(ctx, key, value, ttl)
+	if err != nil || !added {
+		return added, err
+	}
+	return true, tc.invalidate(ctx, key)
+}
+
+func (tc *TieredCache) Increment(key string, by int64) (int64, error) {
+	return tc.IncrementCtx(context.Background(), key, by)
+}
+
+func (tc *TieredCache) IncrementCtx(ctx context.Context, key string, by int64) (int64, error) {
+	value, err := tc.remote.IncrementCtx(ctx, key, by)
+	if err != nil {
+		return 0, err
+	}
+	return value, tc.invalidate(ctx, key)
+}
+
+func (tc *TieredCache) Decrement(key string, by int64) (int64, error) {
+	return tc.IncrementCtx(context.Background(), key, -by)
+}
+
+func (tc *TieredCache) DecrementCtx(ctx context.Context, key string, by int64) (int64, error) {
+	return tc.IncrementCtx(ctx, key, -by)
+}
+
+func (tc *TieredCache) Pull(key string, dest interface{}) error {
+	return tc.PullCtx(context.Background(), key, dest)
+}
+
+func (tc *TieredCache) PullCtx(ctx context.Context, key string, dest interface{}) error {
+	if err := tc.remote.PullCtx(ctx, key, dest); err != nil {
+		return err
+	}
+	return tc.invalidate(ctx, key)
+}
+
+func (tc *TieredCache) Forever(key string, value interface{}) error {
+	return tc.SetCtx(context.Background(), key, value, 0)
+}
+
+func (tc *TieredCache) ForeverCtx(ctx context.Context, key string, value interface{}) error {
+	return tc.SetCtx(ctx, key, value, 0)
+}
+
+// Lock returns a lock held in Redis
+func (tc *TieredCache) Lock(name string, ttl time.Duration) Lock {
+	return tc.remote.Lock(name, ttl)
+}
+
+func (tc *TieredCache) RestoreLock(name, owner string) Lock {
+	return tc.remote.RestoreLock(name, owner)
+}
+
+func (tc *TieredCache) Remember(key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return tc.RememberCtx(context.Background(), key, ttl, callback, dest)
+}
+
+func (tc *TieredCache) RememberCtx(ctx context.Context, key string, ttl time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return remember(ctx, tc, &tc.group, key, ttl, tc.remote.lockedLoad(ctx, key, callback), dest)
+}
+
+func (tc *TieredCache) Flexible(key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return tc.FlexibleCtx(context.Background(), key, fresh, stale, callback, dest)
+}
+
+func (tc *TieredCache) FlexibleCtx(ctx context.Context, key string, fresh, stale time.Duration, callback func() (interface{}, error), dest interface{}) error {
+	return flexible(ctx, tc, &tc.group, tc.remote.refreshLock, key, fresh, stale, callback, dest)
+}
+
+// Tags returns a view of the cache that records keys under the given tags
+func (tc *TieredCache) Tags(names ...string) *TaggedCache {
+	return newTaggedCache(tc, names)
+}
+
+func (tc *TieredCache) tagKeys(ctx context.Context, tags []string, key string, ttl time.Duration) error {
+	return tc.remote.tagKeys(ctx, tags, key, ttl)
+}
+
+// flushTags flushes the tagged keys in Redis. Local tiers only know keys,
+// not tags, so they are flushed completely.
+func (tc *TieredCache) flushTags(ctx context.Context, tags []string) error {
+	if err := tc.remote.flushTags(ctx, tags); err != nil {
+		return err
+	}
+	tc.flushLocal()
+	return tc.publish(ctx, invalidation{Origin: tc.origin, Flush: true})
+}
+
+func (tc *TieredCache) flights() *flightGroup {
+	return &tc.group
+}
+
+func (tc *TieredCache) refreshLock(key string) (func(), bool) {
+	return tc.remote.refreshLock(key)
+}
+
+// Close unsubscribes from invalidations and closes the local tier. The
+// remote store is left open.
+func (tc *TieredCache) Close() error {
+	err := tc.pubsub.Close()
+	<-tc.done
+	tc.local.Close()
+	return err
+}
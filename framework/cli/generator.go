@@ -80,7 +80,11 @@ func (ctrl *{{.Name}}Controller) Index(c *fiber.Ctx) error {
 	perPage, _ := strconv.Atoi(c.Query("per_page", "15"))
 	
 	// Use query builder for pagination
-	qb := database.NewQueryBuilder(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	qb := database.NewQueryBuilder(db)
 	result, err := qb.Table("{{.LowerName}}s").
 		OrderBy("created_at", "DESC").
 		Paginate(page, perPage, &{{.LowerName}}s)
@@ -105,7 +109,11 @@ func (ctrl *{{.Name}}Controller) Show(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var {{.LowerName}} models.{{.Name}}
 	
-	model := database.NewModel(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Find(&{{.LowerName}}, id); err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"success": false,
@@ -143,7 +151,11 @@ func (ctrl *{{.Name}}Controller) Store(c *fiber.Ctx) error {
 		})
 	}
 	
-	model := database.NewModel(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Create(&{{.LowerName}}); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"success": false,
@@ -165,7 +177,11 @@ func (ctrl *{{.Name}}Controller) Update(c *fiber.Ctx) error {
 	var {{.LowerName}} models.{{.Name}}
 	
 	// Find existing {{.LowerName}}
-	model := database.NewModel(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Find(&{{.LowerName}}, id); err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"success": false,
@@ -204,7 +220,11 @@ func (ctrl *{{.Name}}Controller) Destroy(c *fiber.Ctx) error {
 	var {{.LowerName}} models.{{.Name}}
 	
 	// Find existing {{.LowerName}}
-	model := database.NewModel(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Find(&{{.LowerName}}, id); err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"success": false,
@@ -266,7 +286,11 @@ func (ctrl *{{.Name}}Controller) Index(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	perPage := 15
 	
-	qb := database.NewQueryBuilder(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	qb := database.NewQueryBuilder(db)
 	result, err := qb.Table("{{.LowerName}}s").
 		OrderBy("created_at", "DESC").
 		Paginate(page, perPage, &{{.LowerName}}s)
@@ -287,7 +311,11 @@ func (ctrl *{{.Name}}Controller) Show(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var {{.LowerName}} models.{{.Name}}
 	
-	model := database.NewModel(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Find(&{{.LowerName}}, id); err != nil {
 		return c.Status(404).SendString("{{.Name}} not found")
 	}
@@ -312,7 +340,11 @@ func (ctrl *{{.Name}}Controller) Store(c *fiber.Ctx) error {
 		return c.Redirect("/{{.LowerName}}s/create")
 	}
 	
-	model := database.NewModel(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Create(&{{.LowerName}}); err != nil {
 		return c.Redirect("/{{.LowerName}}s/create")
 	}
@@ -325,7 +357,11 @@ func (ctrl *{{.Name}}Controller) Edit(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var {{.LowerName}} models.{{.Name}}
 	
-	model := database.NewModel(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Find(&{{.LowerName}}, id); err != nil {
 		return c.Status(404).SendString("{{.Name}} not found")
 	}
@@ -341,7 +377,11 @@ func (ctrl *{{.Name}}Controller) Update(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var {{.LowerName}} models.{{.Name}}
 	
-	model := database.NewModel(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Find(&{{.LowerName}}, id); err != nil {
 		return c.Status(404).SendString("{{.Name}} not found")
 	}
@@ -363,7 +403,11 @@ func (ctrl *{{.Name}}Controller) Destroy(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var {{.LowerName}} models.{{.Name}}
 	
-	model := database.NewModel(ctrl.DB.Connection())
+	db, err := ctrl.DB.Connection()
+	if err != nil {
+		return err
+	}
+	model := database.NewModel(db)
 	if err := model.Find(&{{.LowerName}}, id); err != nil {
 		return c.Status(404).SendString("{{.Name}} not found")
 	}
@@ -397,6 +441,8 @@ func (g *Generator) GenerateMigration(name string) error {
 	migrationTemplate := `package migrations
 
 import (
+	"{{.ModuleName}}/framework/database/schema"
+
 	"gorm.io/gorm"
 )
 
@@ -405,31 +451,29 @@ func {{.Name}}Migration() (string, func(*gorm.DB) error, func(*gorm.DB) error) {
 	return "{{.FileName}}",
 		// Up
 		func(db *gorm.DB) error {
-			return db.Exec(` + "`" + `
-				CREATE TABLE {{.LowerName}}s (
-					id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
-					created_at TIMESTAMP NULL,
-					updated_at TIMESTAMP NULL,
-					deleted_at TIMESTAMP NULL,
-					INDEX idx_{{.LowerName}}s_deleted_at (deleted_at)
-				)
-			` + "`" + `).Error
+			return schema.New(db).Create("{{.LowerName}}s", func(t *schema.Blueprint) {
+				t.ID()
+				t.Timestamps()
+				t.SoftDeletes()
+			})
 		},
 		// Down
 		func(db *gorm.DB) error {
-			return db.Exec("DROP TABLE IF EXISTS {{.LowerName}}s").Error
+			return schema.New(db).DropIfExists("{{.LowerName}}s")
 		}
 }
 `
 
 	data := struct {
-		Name      string
-		LowerName string
-		FileName  string
+		Name       string
+		LowerName  string
+		FileName   string
+		ModuleName string
 	}{
-		Name:      strings.Title(name),
-		LowerName: strings.ToLower(name),
-		FileName:  fileName,
+		Name:       strings.Title(name),
+		LowerName:  strings.ToLower(name),
+		FileName:   fileName,
+		ModuleName: g.moduleName,
 	}
 
 	return g.generateFromTemplate(migrationTemplate, fmt.Sprintf("database/migrations/%s.go", fileName), data)
@@ -0,0 +1,299 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Delays between attempts to open a connection that is down. The delay
+// doubles after each failure, up to MaxReconnectDelay.
+const (
+	DefaultReconnectDelay = 500 * time.Millisecond
+	MaxReconnectDelay     = 30 * time.Second
+)
+
+// healthCheckTimeout bounds each connection's ping in Health
+const healthCheckTimeout = 2 * time.Second
+
+// connection is a registered connection, opened on first use
+type connection struct {
+	name   string
+	config DatabaseConfig
+	db     atomic.Pointer[gorm.DB]
+
+	mutex    sync.Mutex
+	pool     *replicaPool
+	logFile  *os.File
+	failures int
+	retryAt  time.Time
+	lastErr  error
+}
+
+// get returns the open connection, opening it unless the last attempt
+// failed less than a backoff delay ago
+func (c *connection) get() (*gorm.DB, error) {
+	return c.load(false)
+}
+
+// connect opens the connection now, ignoring the backoff delay
+func (c *connection) connect() (*gorm.DB, error) {
+	return c.load(true)
+}
+
+func (c *connection) load(force bool) (*gorm.DB, error) {
+	if db := c.db.Load(); db != nil {
+		return db, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if db := c.db.Load(); db != nil {
+		return db, nil
+	}
+	if wait := time.Until(c.retryAt); wait > 0 && !force {
+		return nil, fmt.Errorf("database connection %s is unavailable, retrying in %s: %w",
+			c.name, wait.Round(time.Millisecond), c.lastErr)
+	}
+	return c.openLocked()
+}
+
+func (c *connection) openLocked() (*gorm.DB, error) {
+	db, err := c.open()
+	if err != nil {
+		c.failures++
+		c.retryAt = time.Now().Add(reconnectDelay(c.failures))
+		c.lastErr = err
+		return nil, err
+	}
+
+	c.failures = 0
+	c.retryAt = time.Time{}
+	c.lastErr = nil
+	c.db.Store(db)
+	log.Printf("✅ Connected to %s database: %s", c.config.Driver, c.name)
+	return db, nil
+}
+
+func (c *connection) open() (*gorm.DB, error) {
+	config := c.config
+	dialector, pool, err := config.dialector()
+	if err != nil {
+		return nil, err
+	}
+
+	var logFile *os.File
+	// abandon closes what was opened when the connection cannot be used
+	abandon := func() {
+		if pool != nil {
+			pool.Close()
+			pool.primary.Close()
+		}
+		if logFile != nil {
+			logFile.Close()
+		}
+	}
+
+	dbLogger, logFile, err := config.logger()
+	if err != nil {
+		abandon()
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:                 dbLogger,
+		PrepareStmt:            config.PrepareStmt && pool == nil,
+		SkipDefaultTransaction: config.SkipDefaultTransaction,
+	})
+	if err != nil {
+		abandon()
+		return nil, fmt.Errorf("failed to connect to %s database %s: %w", config.Driver, c.name, err)
+	}
+
+	// Configure connection pool
+	sqlDB, err := db.DB()
+	if err != nil {
+		abandon()
+		return nil, err
+	}
+	config.configurePool(sqlDB)
+	if pool != nil {
+		for _, r := range pool.replicas {
+			config.configurePool(r.db)
+		}
+	}
+
+	c.pool = pool
+	c.logFile = logFile
+	return db, nil
+}
+
+// reconnectDelay returns the delay after the given number of consecutive
+// failures
+func reconnectDelay(failures int) time.Duration {
+	delay := DefaultReconnectDelay
+	for i := 1; i < failures && delay < MaxReconnectDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxReconnectDelay)
+}
+
+func (c *connection) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	db := c.db.Swap(nil)
+	if db == nil {
+		return nil
+	}
+
+	var errs []error
+	if c.pool != nil {
+		if err := c.pool.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("database connection %s replicas: %w", c.name, err))
+		}
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("database connection %s: %w", c.name, err))
+		}
+	}
+	if c.logFile != nil {
+		if err := c.logFile.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("database connection %s log: %w", c.name, err))
+		}
+	}
+	c.pool, c.logFile = nil, nil
+	return errors.Join(errs...)
+}
+
+// ping opens the connection if needed and checks the primary is reachable
+func (c *connection) ping(ctx context.Context) error {
+	db, err := c.get()
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("database connection %s: %w", c.name, err)
+	}
+	return nil
+}
+
+// WaitForConnections opens every registered connection, retrying those
+// that are down with exponential backoff until they open or ctx is done
+func (dm *DatabaseManager) WaitForConnections(ctx context.Context) error {
+	for _, name := range dm.Names() {
+		conn, err := dm.lookup(name)
+		if err != nil {
+			continue
+		}
+
+		for attempt := 1; ; attempt++ {
+			_, err := conn.connect()
+			if err == nil {
+				break
+			}
+
+			delay := reconnectDelay(attempt)
+			log.Printf("⏳ Database connection %s is down, retrying in %s: %v", name, delay, err)
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("database connection %s: %w", name, errors.Join(ctx.Err(), err))
+			case <-time.After(delay):
+			}
+		}
+	}
+	return nil
+}
+
+func (dm *DatabaseManager) lookup(name string) (*connection, error) {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
+
+	conn, exists := dm.connections[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrConnectionNotFound, name)
+	}
+	return conn, nil
+}
+
+// Ping checks every registered connection, opening those that are not
+// open yet, and returns an error for each one that is down
+func (dm *DatabaseManager) Ping(ctx context.Context) error {
+	var errs []error
+	for _, name := range dm.Names() {
+		conn, err := dm.lookup(name)
+		if err != nil {
+			continue
+		}
+		if err := conn.ping(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ConnectionHealth reports the state of one connection
+type ConnectionHealth struct {
+	Driver   string          `json:"driver"`
+	Healthy  bool            `json:"healthy"`
+	Latency  time.Duration   `json:"latency_ns"`
+	Error    string          `json:"error,omitempty"`
+	Open     int             `json:"open_connections"`
+	InUse    int             `json:"in_use"`
+	Idle     int             `json:"idle"`
+	Replicas map[string]bool `json:"replicas,omitempty"`
+}
+
+// Health pings every registered connection and reports its state and pool
+// usage, keyed by connection name
+func (dm *DatabaseManager) Health() map[string]ConnectionHealth {
+	report := make(map[string]ConnectionHealth)
+	for _, name := range dm.Names() {
+		conn, err := dm.lookup(name)
+		if err != nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		started := time.Now()
+		err = conn.ping(ctx)
+		cancel()
+
+		health := ConnectionHealth{
+			Driver:  conn.config.Driver,
+			Healthy: err == nil,
+			Latency: time.Since(started),
+		}
+		if err != nil {
+			health.Error = err.Error()
+		}
+		if db := conn.db.Load(); db != nil {
+			if sqlDB, err := db.DB(); err == nil {
+				stats := sqlDB.Stats()
+				health.Open, health.InUse, health.Idle = stats.OpenConnections, stats.InUse, stats.Idle
+			}
+		}
+		conn.mutex.Lock()
+		if conn.pool != nil {
+			health.Replicas = make(map[string]bool, len(conn.pool.replicas))
+			for _, r := range conn.pool.replicas {
+				health.Replicas[r.host] = r.healthy.Load()
+			}
+		}
+		conn.mutex.Unlock()
+		report[name] = health
+	}
+	return report
+}
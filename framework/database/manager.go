@@ -1,27 +1,37 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"net"
+	"sort"
+	"sync"
 	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-// DatabaseManager manages multiple database connections
+// DatabaseManager manages multiple database connections. Connections are
+// opened on first use, and one that fails to open is retried with
+// exponential backoff.
 type DatabaseManager struct {
-	connections map[string]*gorm.DB
+	connections map[string]*connection
 	default_    string
+	mutex       sync.RWMutex
 }
 
+// ErrConnectionNotFound is returned for connections that were never
+// registered
+var ErrConnectionNotFound = fmt.Errorf("database connection not found")
+
 // NewDatabaseManager creates a new database manager
 func NewDatabaseManager() *DatabaseManager {
 	return &DatabaseManager{
-		connections: make(map[string]*gorm.DB),
+		connections: make(map[string]*connection),
 	}
 }
 
@@ -36,89 +46,272 @@ type DatabaseConfig struct {
 	Charset  string `yaml:"charset"`
 	SSLMode  string `yaml:"sslmode"`
 	Timezone string `yaml:"timezone"`
+	
+	// Client certificates for SSLMode, as file paths
+	SSLRootCert string `yaml:"sslrootcert"`
+	SSLCert     string `yaml:"sslcert"`
+	SSLKey      string `yaml:"sslkey"`
+	
+	// Options are extra DSN parameters, such as collation or timeout for
+	// MySQL, connect_timeout for Postgres and _busy_timeout for SQLite.
+	// They override the parameters built from the fields above.
+	Options map[string]string `yaml:"options"`
+	
+	// Pool settings; zero values use the defaults
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	
+	// LogLevel is silent, error, warn or info; empty means warn. Queries
+	// slower than SlowThreshold, DefaultSlowThreshold if zero, are logged
+	// at warn. LogFile sends the log to a file instead of stdout.
+	LogLevel      string        `yaml:"log_level"`
+	SlowThreshold time.Duration `yaml:"slow_threshold"`
+	LogFile       string        `yaml:"log_file"`
+	
+	// PrepareStmt caches prepared statements. It is ignored on
+	// connections with read replicas, whose reads may go to any replica.
+	PrepareStmt            bool `yaml:"prepare_stmt"`
+	SkipDefaultTransaction bool `yaml:"skip_default_transaction"`
+	
+	// Read replica hosts, as "host" or "host:port" (file paths for sqlite).
+	// With replicas, plain SELECTs go to them in turn and everything else
+	// to Write, or Host when Write is empty.
+	Read   []string `yaml:"read"`
+	Write  string   `yaml:"write"`
+	// Sticky sends reads to the primary after a write made with the same
+	// StickyContext
+	Sticky              bool          `yaml:"sticky"`
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
 }
 
-// Connect establishes database connection
+// Connect registers a connection and opens it now. A connection that fails
+// to open stays registered and is retried on use.
 func (dm *DatabaseManager) Connect(name string, config DatabaseConfig) error {
-	var dialector gorm.Dialector
+	conn, err := dm.register(name, config)
+	if err != nil {
+		return err
+	}
+	_, err = conn.connect()
+	return err
+}
+
+// Register adds a connection that is opened on first use
+func (dm *DatabaseManager) Register(name string, config DatabaseConfig) error {
+	_, err := dm.register(name, config)
+	return err
+}
+
+func (dm *DatabaseManager) register(name string, config DatabaseConfig) (*connection, error) {
+	switch config.Driver {
+	case "mysql", "postgres", "postgresql", "sqlite":
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", config.Driver)
+	}
+	
+	conn := &connection{name: name, config: config}
+	
+	dm.mutex.Lock()
+	previous := dm.connections[name]
+	dm.connections[name] = conn
+	if dm.default_ == "" {
+		dm.default_ = name
+	}
+	dm.mutex.Unlock()
+	
+	if previous != nil {
+		previous.close()
+	}
+	return conn, nil
+}
+
+// dialector returns the dialector for a connection. With read replicas it
+// is backed by a replicaPool, which is returned too.
+func (config DatabaseConfig) dialector() (gorm.Dialector, *replicaPool, error) {
+	dsn, err := config.dsn(config.writeHost())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(config.Read) == 0 {
+		return openDialector(config.Driver, dsn), nil, nil
+	}
+	
+	driverName := sqlDriverName(config.Driver)
+	primary, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	replicas := make([]*replica, 0, len(config.Read))
+	for _, host := range config.Read {
+		replicaDSN, err := config.dsn(host)
+		var db *sql.DB
+		if err == nil {
+			db, err = sql.Open(driverName, replicaDSN)
+		}
+		if err != nil {
+			for _, r := range replicas {
+				r.db.Close()
+			}
+			primary.Close()
+			return nil, nil, fmt.Errorf("read replica %s: %w", host, err)
+		}
+		replicas = append(replicas, &replica{host: host, db: db})
+	}
+	
+	pool := newReplicaPool(primary, replicas, config.Sticky, config.HealthCheckInterval)
+	return dialectorWithConn(config.Driver, pool), pool, nil
+}
+
+// writeHost returns the host writes go to
+func (config DatabaseConfig) writeHost() string {
+	if config.Write != "" {
+		return config.Write
+	}
+	if config.Driver == "sqlite" {
+		return config.Database
+	}
+	return config.Host
+}
+
+// dsn builds the data source name for one host of the connection
+func (config DatabaseConfig) dsn(host string) (string, error) {
+	if config.Driver == "sqlite" {
+		return withQuery(host, encodeOptions(nil, config.Options)), nil
+	}
+	
+	port := config.Port
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	}
 	
 	switch config.Driver {
 	case "mysql":
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=%s&parseTime=True&loc=Local",
-			config.Username, config.Password, config.Host, config.Port, 
-			config.Database, config.Charset)
-		dialector = mysql.Open(dsn)
+		params := map[string]string{
+			"charset":   config.Charset,
+			"parseTime": "True",
+			"loc":       "Local",
+		}
+		if config.Timezone != "" {
+			params["loc"] = config.Timezone
+		}
+		tlsName, err := config.mysqlTLS(host)
+		if err != nil {
+			return "", err
+		}
+		if tlsName != "" {
+			params["tls"] = tlsName
+		}
 		
-	case "postgres", "postgresql":
-		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s",
-			config.Host, config.Username, config.Password, config.Database, 
-			config.Port, config.SSLMode, config.Timezone)
-		dialector = postgres.Open(dsn)
+		return fmt.Sprintf("%s:%s@tcp(%s)/%s?%s",
+			config.Username, config.Password, net.JoinHostPort(host, port), 
+			config.Database, encodeOptions(params, config.Options)), nil
 		
-	case "sqlite":
-		dialector = sqlite.Open(config.Database)
+	case "postgres", "postgresql":
+		params := map[string]string{
+			"host":        host,
+			"port":        port,
+			"user":        config.Username,
+			"password":    config.Password,
+			"dbname":      config.Database,
+			"sslmode":     config.SSLMode,
+			"sslrootcert": config.SSLRootCert,
+			"sslcert":     config.SSLCert,
+			"sslkey":      config.SSLKey,
+			"TimeZone":    config.Timezone,
+		}
+		return postgresDSN(params, config.Options), nil
 		
 	default:
-		return fmt.Errorf("unsupported database driver: %s", config.Driver)
+		return "", fmt.Errorf("unsupported database driver: %s", config.Driver)
 	}
+}
 
-	db, err := gorm.Open(dialector, &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to connect to %s database: %w", config.Driver, err)
+func openDialector(driver, dsn string) gorm.Dialector {
+	switch driver {
+	case "mysql":
+		return mysql.Open(dsn)
+	case "postgres", "postgresql":
+		return postgres.Open(dsn)
+	default:
+		return sqlite.Open(dsn)
 	}
+}
 
-	// Configure connection pool
-	sqlDB, err := db.DB()
-	if err != nil {
-		return err
+func dialectorWithConn(driver string, conn gorm.ConnPool) gorm.Dialector {
+	switch driver {
+	case "mysql":
+		return mysql.New(mysql.Config{Conn: conn})
+	case "postgres", "postgresql":
+		return postgres.New(postgres.Config{Conn: conn})
+	default:
+		return &sqlite.Dialector{Conn: conn}
 	}
-	
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
+}
 
-	dm.connections[name] = db
-	
-	if dm.default_ == "" {
-		dm.default_ = name
+// sqlDriverName returns the database/sql driver the gorm driver registers
+func sqlDriverName(driver string) string {
+	switch driver {
+	case "mysql":
+		return "mysql"
+	case "postgres", "postgresql":
+		return "pgx"
+	default:
+		return sqlite.DriverName
 	}
-	
-	log.Printf("✅ Connected to %s database: %s", config.Driver, name)
-	return nil
 }
 
-// Connection returns a database connection by name
-func (dm *DatabaseManager) Connection(name ...string) *gorm.DB {
+// Connection returns a database connection by name, or the default one,
+// opening it if needed
+func (dm *DatabaseManager) Connection(name ...string) (*gorm.DB, error) {
+	dm.mutex.RLock()
 	connName := dm.default_
 	if len(name) > 0 {
 		connName = name[0]
 	}
+	conn, exists := dm.connections[connName]
+	dm.mutex.RUnlock()
 	
-	if conn, exists := dm.connections[connName]; exists {
-		return conn
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrConnectionNotFound, connName)
 	}
+	return conn.get()
+}
+
+// Names returns the registered connection names in order
+func (dm *DatabaseManager) Names() []string {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
 	
-	log.Printf("⚠️  Database connection '%s' not found, using default", connName)
-	return dm.connections[dm.default_]
+	names := make([]string, 0, len(dm.connections))
+	for name := range dm.connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // SetDefault sets the default connection
 func (dm *DatabaseManager) SetDefault(name string) {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
 	dm.default_ = name
 }
 
-// Close closes all database connections
+// Close closes all database connections and forgets them
 func (dm *DatabaseManager) Close() error {
-	for name, db := range dm.connections {
-		sqlDB, err := db.DB()
-		if err != nil {
-			continue
-		}
-		if err := sqlDB.Close(); err != nil {
-			log.Printf("Error closing database connection %s: %v", name, err)
+	dm.mutex.Lock()
+	connections := dm.connections
+	dm.connections = make(map[string]*connection)
+	dm.default_ = ""
+	dm.mutex.Unlock()
+	
+	var errs []error
+	for _, conn := range connections {
+		if err := conn.close(); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	return nil
-}
\ No newline at end of file
+	return errors.Join(errs...)
+}
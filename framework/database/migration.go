@@ -30,10 +30,11 @@ type Migrator struct {
 	migrations []MigrationFile
 }
 
-// NewMigrator creates a new migrator
+// NewMigrator creates a new migrator. Migrations always run against the
+// primary, so they see their own schema changes.
 func NewMigrator(db *gorm.DB) *Migrator {
 	return &Migrator{
-		db:         db,
+		db:         db.WithContext(UsePrimary(statementContext(db))),
 		migrations: make([]MigrationFile, 0),
 	}
 }
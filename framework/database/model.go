@@ -1,6 +1,8 @@
 package database
 
 import (
+	"context"
+
 	"gorm.io/gorm"
 )
 
@@ -14,6 +16,18 @@ func NewModel(db *gorm.DB) *Model {
 	return &Model{DB: db}
 }
 
+// WithContext returns the model bound to ctx, joining the transaction ctx
+// carries for this connection if there is one
+func (m *Model) WithContext(ctx context.Context) *Model {
+	return &Model{DB: Tx(ctx, m.DB)}
+}
+
+// UsePrimary returns the model with reads sent to the primary on a
+// connection with replicas
+func (m *Model) UsePrimary() *Model {
+	return &Model{DB: m.DB.WithContext(UsePrimary(statementContext(m.DB)))}
+}
+
 // Query returns a new query builder
 func (m *Model) Query() *QueryBuilder {
 	return NewQueryBuilder(m.DB)
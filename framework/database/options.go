@@ -0,0 +1,198 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm/logger"
+)
+
+// Pool defaults for settings left at zero
+const (
+	DefaultMaxIdleConns    = 10
+	DefaultMaxOpenConns    = 100
+	DefaultConnMaxLifetime = time.Hour
+	DefaultSlowThreshold   = 200 * time.Millisecond
+)
+
+func (config DatabaseConfig) configurePool(sqlDB *sql.DB) {
+	sqlDB.SetMaxIdleConns(orDefault(config.MaxIdleConns, DefaultMaxIdleConns))
+	sqlDB.SetMaxOpenConns(orDefault(config.MaxOpenConns, DefaultMaxOpenConns))
+	sqlDB.SetConnMaxLifetime(orDefault(config.ConnMaxLifetime, DefaultConnMaxLifetime))
+	sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+}
+
+func orDefault[T int | time.Duration](value, fallback T) T {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// logger builds the connection's logger. The log file it opens, if any, is
+// returned so it can be closed with the connection.
+func (config DatabaseConfig) logger() (logger.Interface, *os.File, error) {
+	level, err := parseLogLevel(config.LogLevel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out *os.File
+	writer := os.Stdout
+	if config.LogFile != "" {
+		if err := os.MkdirAll(filepath.Dir(config.LogFile), 0755); err != nil {
+			return nil, nil, fmt.Errorf("database log: %w", err)
+		}
+		out, err = os.OpenFile(config.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("database log: %w", err)
+		}
+		writer = out
+	}
+
+	return logger.New(log.New(writer, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold:             orDefault(config.SlowThreshold, DefaultSlowThreshold),
+		LogLevel:                  level,
+		IgnoreRecordNotFoundError: true,
+		Colorful:                  out == nil,
+	}), out, nil
+}
+
+func parseLogLevel(level string) (logger.LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "silent":
+		return logger.Silent, nil
+	case "error":
+		return logger.Error, nil
+	case "", "warn", "warning":
+		return logger.Warn, nil
+	case "info":
+		return logger.Info, nil
+	default:
+		return 0, fmt.Errorf("unknown database log level %q", level)
+	}
+}
+
+// mysqlTLS returns the tls parameter for SSLMode, which takes the Postgres
+// names. With certificate files a TLS config is registered with the driver;
+// verify-ca checks the hostname too. Other values, such as the name of a
+// config registered with the driver, are passed through.
+func (config DatabaseConfig) mysqlTLS(host string) (string, error) {
+	var verify bool
+	switch config.SSLMode {
+	case "":
+		return "", nil
+	case "disable":
+		return "false", nil
+	case "allow", "prefer":
+		return "preferred", nil
+	case "require":
+		verify = false
+	case "verify-ca", "verify-full":
+		verify = true
+	default:
+		return config.SSLMode, nil
+	}
+
+	if config.SSLRootCert == "" && config.SSLCert == "" {
+		if verify {
+			return "true", nil
+		}
+		return "skip-verify", nil
+	}
+
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: !verify}
+	if config.SSLRootCert != "" {
+		pem, err := os.ReadFile(config.SSLRootCert)
+		if err != nil {
+			return "", fmt.Errorf("database ssl root cert: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("database ssl root cert %s has no certificates", config.SSLRootCert)
+		}
+	}
+	if config.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(config.SSLCert, config.SSLKey)
+		if err != nil {
+			return "", fmt.Errorf("database ssl cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	name := "golara-" + host + "-" + config.Database
+	if err := mysqldriver.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// encodeOptions merges options over params and encodes them as a query
+// string, leaving out empty values
+func encodeOptions(params, options map[string]string) string {
+	merged := mergeOptions(params, options)
+	pairs := make([]string, 0, len(merged))
+	for _, key := range sortedKeys(merged) {
+		if merged[key] != "" {
+			pairs = append(pairs, key+"="+url.QueryEscape(merged[key]))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func mergeOptions(params, options map[string]string) map[string]string {
+	merged := make(map[string]string, len(params)+len(options))
+	for key, value := range params {
+		merged[key] = value
+	}
+	for key, value := range options {
+		merged[key] = value
+	}
+	return merged
+}
+
+func withQuery(dsn, query string) string {
+	if query == "" {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + query
+	}
+	return dsn + "?" + query
+}
+
+// postgresDSN builds a keyword/value DSN, quoting values as libpq expects
+func postgresDSN(params, options map[string]string) string {
+	merged := mergeOptions(params, options)
+	pairs := make([]string, 0, len(merged))
+	for _, key := range sortedKeys(merged) {
+		value := merged[key]
+		if value == "" {
+			continue
+		}
+		if strings.ContainsAny(value, ` '\`) {
+			value = "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, " ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -31,6 +32,25 @@ func NewQueryBuilder(db *gorm.DB) *QueryBuilder {
 	}
 }
 
+// WithContext runs the query with ctx, joining the transaction ctx carries
+// for this connection if there is one. Conditions already added are kept.
+func (qb *QueryBuilder) WithContext(ctx context.Context) *QueryBuilder {
+	t := ambient(ctx, qb.db)
+	qb.db = Tx(ctx, qb.db)
+	qb.query = qb.query.WithContext(ctx)
+	if t != nil {
+		qb.query.Statement.ConnPool = t.tx.Statement.ConnPool
+	}
+	return qb
+}
+
+// UsePrimary sends the query to the primary even when it is a read on a
+// connection with replicas
+func (qb *QueryBuilder) UsePrimary() *QueryBuilder {
+	qb.query = qb.query.WithContext(UsePrimary(statementContext(qb.query)))
+	return qb
+}
+
 // Table sets the table name
 func (qb *QueryBuilder) Table(table string) *QueryBuilder {
 	qb.table = table
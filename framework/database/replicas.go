@@ -0,0 +1,252 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultReplicaHealthCheckInterval is how often read replicas are pinged
+const DefaultReplicaHealthCheckInterval = 10 * time.Second
+
+// replicaPingTimeout bounds each replica health check
+const replicaPingTimeout = 2 * time.Second
+
+// replicaPool is a gorm.ConnPool that sends plain SELECTs to healthy read
+// replicas in turn and everything else, including transactions and locking
+// reads, to the primary
+type replicaPool struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     atomic.Uint64
+	sticky   bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type replica struct {
+	host    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+func newReplicaPool(primary *sql.DB, replicas []*replica, sticky bool, interval time.Duration) *replicaPool {
+	if interval <= 0 {
+		interval = DefaultReplicaHealthCheckInterval
+	}
+
+	p := &replicaPool{
+		primary:  primary,
+		replicas: replicas,
+		sticky:   sticky,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, r := range replicas {
+		r.healthy.Store(true)
+	}
+	p.checkHealth()
+	go p.monitor(interval)
+	return p
+}
+
+// monitor pings the replicas until the pool is closed
+func (p *replicaPool) monitor(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.checkHealth()
+		}
+	}
+}
+
+func (p *replicaPool) checkHealth() {
+	for _, r := range p.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaPingTimeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+		p.setHealthy(r, err == nil)
+	}
+}
+
+func (p *replicaPool) setHealthy(r *replica, healthy bool) {
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		log.Printf("✅ Database read replica %s is back", r.host)
+	} else {
+		log.Printf("⚠️  Database read replica %s is down, reading from the primary", r.host)
+	}
+}
+
+// pick returns the next healthy replica, or nil when there is none
+func (p *replicaPool) pick() *replica {
+	n := uint64(len(p.replicas))
+	start := p.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := p.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// route returns the replica a statement should run on, or nil for the
+// primary
+func (p *replicaPool) route(ctx context.Context, query string) *replica {
+	if !isRead(query) || usesPrimary(ctx) || (p.sticky && wrote(ctx)) {
+		return nil
+	}
+	return p.pick()
+}
+
+// isRead reports whether a statement is a SELECT that does not lock rows
+func isRead(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	if len(query) < 6 || !strings.EqualFold(query[:6], "SELECT") {
+		return false
+	}
+
+	upper := strings.ToUpper(query)
+	return !strings.Contains(upper, " FOR UPDATE") &&
+		!strings.Contains(upper, " FOR SHARE") &&
+		!strings.Contains(upper, " LOCK IN SHARE MODE")
+}
+
+// unreachable reports whether err means the replica could not be reached,
+// rather than that the query failed
+func unreachable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
+
+func (p *replicaPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if r := p.route(ctx, query); r != nil {
+		return r.db.PrepareContext(ctx, query)
+	}
+	markWrite(ctx, query)
+	return p.primary.PrepareContext(ctx, query)
+}
+
+func (p *replicaPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	markWrite(ctx, query)
+	return p.primary.ExecContext(ctx, query, args...)
+}
+
+// QueryContext runs reads on a replica, falling back to the primary when
+// the replica cannot be reached
+func (p *replicaPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if r := p.route(ctx, query); r != nil {
+		rows, err := r.db.QueryContext(ctx, query, args...)
+		if err == nil || !unreachable(err) {
+			return rows, err
+		}
+		p.setHealthy(r, false)
+	}
+	markWrite(ctx, query)
+	return p.primary.QueryContext(ctx, query, args...)
+}
+
+func (p *replicaPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if r := p.route(ctx, query); r != nil {
+		row := r.db.QueryRowContext(ctx, query, args...)
+		if err := row.Err(); err == nil || !unreachable(err) {
+			return row
+		}
+		p.setHealthy(r, false)
+	}
+	markWrite(ctx, query)
+	return p.primary.QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx starts transactions on the primary. With sticky reads, the rest
+// of the context's reads go to the primary too.
+func (p *replicaPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	markWrite(ctx, "")
+	return p.primary.BeginTx(ctx, opts)
+}
+
+// GetDBConn returns the primary, which gorm uses for DB()
+func (p *replicaPool) GetDBConn() (*sql.DB, error) {
+	return p.primary, nil
+}
+
+func (p *replicaPool) Ping() error {
+	return p.primary.Ping()
+}
+
+// Close stops the health checks and closes the replicas. The primary is
+// closed through DB().
+func (p *replicaPool) Close() error {
+	close(p.stop)
+	<-p.done
+
+	var errs []error
+	for _, r := range p.replicas {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type primaryKey struct{}
+
+// UsePrimary returns a context whose queries all go to the primary, for
+// reads that must see the latest writes
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usesPrimary(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryKey{}).(bool)
+	return forced
+}
+
+// statementContext returns the context db runs its statements with
+func statementContext(db *gorm.DB) context.Context {
+	if db.Statement != nil && db.Statement.Context != nil {
+		return db.Statement.Context
+	}
+	return context.Background()
+}
+
+type stickyKey struct{}
+
+// StickyContext returns a context that remembers writes made with it. On
+// connections with Sticky set, its reads go to the primary after the first
+// write, so a request reads its own writes despite replica lag.
+func StickyContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, stickyKey{}, new(atomic.Bool))
+}
+
+// markWrite records a write in the context's sticky scope
+func markWrite(ctx context.Context, query string) {
+	if query != "" && isRead(query) {
+		return
+	}
+	if written, ok := ctx.Value(stickyKey{}).(*atomic.Bool); ok {
+		written.Store(true)
+	}
+}
+
+func wrote(ctx context.Context) bool {
+	written, ok := ctx.Value(stickyKey{}).(*atomic.Bool)
+	return ok && written.Load()
+}
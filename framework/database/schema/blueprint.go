@@ -0,0 +1,344 @@
+package schema
+
+import (
+	"strings"
+
+	"github.com/jinzhu/inflection"
+)
+
+// Blueprint describes the columns, indexes and foreign keys of a table being
+// created or altered
+type Blueprint struct {
+	table    string
+	columns  []*Column
+	commands []*command
+}
+
+// Column is a column definition. Its modifiers return the column so they
+// can be chained.
+type Column struct {
+	blueprint *Blueprint
+
+	name          string
+	kind          string
+	length        int
+	precision     int
+	scale         int
+	nullable      bool
+	unsigned      bool
+	autoIncrement bool
+	hasDefault    bool
+	defaultValue  interface{}
+}
+
+// ForeignKey is a foreign key constraint
+type ForeignKey struct {
+	name       string
+	columns    []string
+	on         string
+	references []string
+	onDelete   string
+	onUpdate   string
+}
+
+// command is a table-level change: an index, a key, or a drop or rename
+type command struct {
+	kind    string
+	name    string
+	columns []string
+	to      string
+	foreign *ForeignKey
+}
+
+// Command kinds
+const (
+	commandIndex        = "index"
+	commandUnique       = "unique"
+	commandPrimary      = "primary"
+	commandForeign      = "foreign"
+	commandDropColumn   = "dropColumn"
+	commandRenameColumn = "renameColumn"
+	commandDropIndex    = "dropIndex"
+	commandDropForeign  = "dropForeign"
+)
+
+// Column kinds
+const (
+	kindBigIncrements = "bigIncrements"
+	kindString        = "string"
+	kindText          = "text"
+	kindInteger       = "integer"
+	kindBigInteger    = "bigInteger"
+	kindBoolean       = "boolean"
+	kindDecimal       = "decimal"
+	kindDouble        = "double"
+	kindDate          = "date"
+	kindDateTime      = "dateTime"
+	kindTimestamp     = "timestamp"
+	kindJSON          = "json"
+	kindUUID          = "uuid"
+)
+
+// DefaultStringLength is the length of String columns given no length
+const DefaultStringLength = 255
+
+func newBlueprint(table string) *Blueprint {
+	return &Blueprint{table: table}
+}
+
+func (b *Blueprint) addColumn(kind, name string) *Column {
+	column := &Column{blueprint: b, kind: kind, name: name}
+	b.columns = append(b.columns, column)
+	return column
+}
+
+func (b *Blueprint) addCommand(c *command) *command {
+	b.commands = append(b.commands, c)
+	return c
+}
+
+// ID adds an auto-incrementing unsigned big integer primary key, named id
+// unless a name is given
+func (b *Blueprint) ID(name ...string) *Column {
+	column := "id"
+	if len(name) > 0 {
+		column = name[0]
+	}
+	c := b.addColumn(kindBigIncrements, column)
+	c.unsigned, c.autoIncrement = true, true
+	return c
+}
+
+// String adds a VARCHAR column, DefaultStringLength long unless a length is
+// given
+func (b *Blueprint) String(name string, length ...int) *Column {
+	c := b.addColumn(kindString, name)
+	c.length = DefaultStringLength
+	if len(length) > 0 {
+		c.length = length[0]
+	}
+	return c
+}
+
+// Text adds a TEXT column
+func (b *Blueprint) Text(name string) *Column {
+	return b.addColumn(kindText, name)
+}
+
+// Integer adds an INTEGER column
+func (b *Blueprint) Integer(name string) *Column {
+	return b.addColumn(kindInteger, name)
+}
+
+// BigInteger adds a BIGINT column
+func (b *Blueprint) BigInteger(name string) *Column {
+	return b.addColumn(kindBigInteger, name)
+}
+
+// ForeignID adds an unsigned big integer column for a foreign key; chain
+// Constrained to add the constraint
+func (b *Blueprint) ForeignID(name string) *Column {
+	return b.BigInteger(name).Unsigned()
+}
+
+// Boolean adds a boolean column
+func (b *Blueprint) Boolean(name string) *Column {
+	return b.addColumn(kindBoolean, name)
+}
+
+// Decimal adds a DECIMAL column with the given precision and scale
+func (b *Blueprint) Decimal(name string, precision, scale int) *Column {
+	c := b.addColumn(kindDecimal, name)
+	c.precision, c.scale = precision, scale
+	return c
+}
+
+// Double adds a double precision floating point column
+func (b *Blueprint) Double(name string) *Column {
+	return b.addColumn(kindDouble, name)
+}
+
+// Date adds a DATE column
+func (b *Blueprint) Date(name string) *Column {
+	return b.addColumn(kindDate, name)
+}
+
+// DateTime adds a date and time column without a time zone
+func (b *Blueprint) DateTime(name string) *Column {
+	return b.addColumn(kindDateTime, name)
+}
+
+// Timestamp adds a TIMESTAMP column
+func (b *Blueprint) Timestamp(name string) *Column {
+	return b.addColumn(kindTimestamp, name)
+}
+
+// JSON adds a JSON column; SQLite stores it as TEXT
+func (b *Blueprint) JSON(name string) *Column {
+	return b.addColumn(kindJSON, name)
+}
+
+// UUID adds a UUID column; MySQL and SQLite store it as 36 characters
+func (b *Blueprint) UUID(name string) *Column {
+	return b.addColumn(kindUUID, name)
+}
+
+// Timestamps adds the nullable created_at and updated_at columns gorm
+// fills in
+func (b *Blueprint) Timestamps() {
+	b.Timestamp("created_at").Nullable()
+	b.Timestamp("updated_at").Nullable()
+}
+
+// SoftDeletes adds the indexed, nullable deleted_at column used by
+// gorm.DeletedAt
+func (b *Blueprint) SoftDeletes() {
+	b.Timestamp("deleted_at").Nullable().Index()
+}
+
+// Index adds an index on the columns, named idx_<table>_<columns>
+func (b *Blueprint) Index(columns ...string) {
+	b.addCommand(&command{kind: commandIndex, name: b.IndexName(columns...), columns: columns})
+}
+
+// Unique adds a unique index on the columns, named idx_<table>_<columns>
+func (b *Blueprint) Unique(columns ...string) {
+	b.addCommand(&command{kind: commandUnique, name: b.IndexName(columns...), columns: columns})
+}
+
+// Primary sets a composite primary key
+func (b *Blueprint) Primary(columns ...string) {
+	b.addCommand(&command{kind: commandPrimary, columns: columns})
+}
+
+// Foreign adds a foreign key on the column, named fk_<table>_<column>;
+// chain References and On to say what it points to
+func (b *Blueprint) Foreign(column string) *ForeignKey {
+	key := &ForeignKey{
+		name:       "fk_" + b.table + "_" + column,
+		columns:    []string{column},
+		references: []string{"id"},
+	}
+	b.addCommand(&command{kind: commandForeign, foreign: key})
+	return key
+}
+
+// DropColumn drops the columns
+func (b *Blueprint) DropColumn(columns ...string) {
+	for _, column := range columns {
+		b.addCommand(&command{kind: commandDropColumn, name: column})
+	}
+}
+
+// RenameColumn renames a column
+func (b *Blueprint) RenameColumn(from, to string) {
+	b.addCommand(&command{kind: commandRenameColumn, name: from, to: to})
+}
+
+// DropIndex drops an index or unique index by name
+func (b *Blueprint) DropIndex(name string) {
+	b.addCommand(&command{kind: commandDropIndex, name: name})
+}
+
+// DropForeign drops a foreign key by name. SQLite cannot drop foreign keys.
+func (b *Blueprint) DropForeign(name string) {
+	b.addCommand(&command{kind: commandDropForeign, name: name})
+}
+
+// IndexName returns the name Index and Unique give an index on the columns
+func (b *Blueprint) IndexName(columns ...string) string {
+	return "idx_" + b.table + "_" + strings.Join(columns, "_")
+}
+
+// adds reports whether the blueprint adds the column
+func (b *Blueprint) adds(name string) bool {
+	for _, column := range b.columns {
+		if column.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Nullable allows NULL in the column
+func (c *Column) Nullable() *Column {
+	c.nullable = true
+	return c
+}
+
+// Default sets the column's default value. Strings are quoted; use Raw for
+// SQL expressions such as CURRENT_TIMESTAMP.
+func (c *Column) Default(value interface{}) *Column {
+	c.hasDefault, c.defaultValue = true, value
+	return c
+}
+
+// Unsigned makes an integer column unsigned on MySQL; other databases
+// ignore it
+func (c *Column) Unsigned() *Column {
+	c.unsigned = true
+	return c
+}
+
+// Index adds an index on the column
+func (c *Column) Index() *Column {
+	c.blueprint.Index(c.name)
+	return c
+}
+
+// Unique adds a unique index on the column
+func (c *Column) Unique() *Column {
+	c.blueprint.Unique(c.name)
+	return c
+}
+
+// Constrained adds a foreign key from the column to the id of the given
+// table, or of the table named after the column the way gorm names tables:
+// user_id references users
+func (c *Column) Constrained(table ...string) *ForeignKey {
+	on := inflection.Plural(strings.TrimSuffix(c.name, "_id"))
+	if len(table) > 0 {
+		on = table[0]
+	}
+	return c.blueprint.Foreign(c.name).On(on)
+}
+
+// References sets the referenced column, id by default
+func (f *ForeignKey) References(columns ...string) *ForeignKey {
+	f.references = columns
+	return f
+}
+
+// On sets the referenced table
+func (f *ForeignKey) On(table string) *ForeignKey {
+	f.on = table
+	return f
+}
+
+// OnDelete sets the action on delete, such as CASCADE or SET NULL
+func (f *ForeignKey) OnDelete(action string) *ForeignKey {
+	f.onDelete = action
+	return f
+}
+
+// OnUpdate sets the action on update
+func (f *ForeignKey) OnUpdate(action string) *ForeignKey {
+	f.onUpdate = action
+	return f
+}
+
+// CascadeOnDelete deletes rows when the row they reference is deleted
+func (f *ForeignKey) CascadeOnDelete() *ForeignKey {
+	return f.OnDelete("CASCADE")
+}
+
+// NullOnDelete sets the column to NULL when the row it references is
+// deleted
+func (f *ForeignKey) NullOnDelete() *ForeignKey {
+	return f.OnDelete("SET NULL")
+}
+
+// Name returns the constraint's name, for DropForeign
+func (f *ForeignKey) Name() string {
+	return f.name
+}
@@ -0,0 +1,87 @@
+// Package schema builds tables for migrations from Blueprints, compiling
+// them to the SQL of MySQL, Postgres or SQLite
+package schema
+
+import (
+	"gorm.io/gorm"
+)
+
+// Builder changes the schema of a connection
+type Builder struct {
+	db *gorm.DB
+}
+
+// New creates a schema builder for db
+func New(db *gorm.DB) *Builder {
+	return &Builder{db: db}
+}
+
+// Create creates a table from the blueprint fn fills in
+func (b *Builder) Create(table string, fn func(t *Blueprint)) error {
+	statements, err := CreateSQL(b.db.Dialector.Name(), table, fn)
+	if err != nil {
+		return err
+	}
+	return b.exec(statements...)
+}
+
+// Table alters a table: it adds the blueprint's columns, indexes and
+// foreign keys and applies its drops and renames
+func (b *Builder) Table(table string, fn func(t *Blueprint)) error {
+	statements, err := TableSQL(b.db.Dialector.Name(), table, fn)
+	if err != nil {
+		return err
+	}
+	return b.exec(statements...)
+}
+
+// Drop drops a table
+func (b *Builder) Drop(table string) error {
+	g, err := grammarFor(b.db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	return b.exec(g.compileDrop(table, false))
+}
+
+// DropIfExists drops a table if it exists
+func (b *Builder) DropIfExists(table string) error {
+	g, err := grammarFor(b.db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	return b.exec(g.compileDrop(table, true))
+}
+
+// Rename renames a table
+func (b *Builder) Rename(from, to string) error {
+	g, err := grammarFor(b.db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	return b.exec(g.compileRename(from, to))
+}
+
+// HasTable reports whether a table exists
+func (b *Builder) HasTable(table string) bool {
+	return b.db.Migrator().HasTable(table)
+}
+
+// exec runs the statements. Postgres and SQLite run them in a transaction,
+// so a failed index leaves no half-built table; MySQL commits each DDL
+// statement on its own.
+func (b *Builder) exec(statements ...string) error {
+	run := func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(statements) == 1 || b.db.Dialector.Name() == "mysql" {
+		return run(b.db)
+	}
+	return b.db.Transaction(run)
+}
@@ -0,0 +1,321 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Raw is a default value that is written as SQL instead of being quoted
+type Raw string
+
+// grammar compiles blueprints to the SQL of one database
+type grammar struct {
+	dialect string
+}
+
+func grammarFor(dialect string) (grammar, error) {
+	switch dialect {
+	case "mysql", "sqlite":
+		return grammar{dialect: dialect}, nil
+	case "postgres", "postgresql":
+		return grammar{dialect: "postgres"}, nil
+	default:
+		return grammar{}, fmt.Errorf("schema: unsupported database %q", dialect)
+	}
+}
+
+// CreateSQL returns the statements that create table on dialect, one of
+// mysql, postgres or sqlite
+func CreateSQL(dialect, table string, fn func(t *Blueprint)) ([]string, error) {
+	g, err := grammarFor(dialect)
+	if err != nil {
+		return nil, err
+	}
+	b := newBlueprint(table)
+	fn(b)
+	return g.compileCreate(b)
+}
+
+// TableSQL returns the statements that alter table on dialect
+func TableSQL(dialect, table string, fn func(t *Blueprint)) ([]string, error) {
+	g, err := grammarFor(dialect)
+	if err != nil {
+		return nil, err
+	}
+	b := newBlueprint(table)
+	fn(b)
+	return g.compileAlter(b)
+}
+
+func (g grammar) compileCreate(b *Blueprint) ([]string, error) {
+	definitions := make([]string, 0, len(b.columns))
+	for _, column := range b.columns {
+		definitions = append(definitions, g.column(column))
+	}
+
+	var statements []string
+	for _, c := range b.commands {
+		switch c.kind {
+		case commandPrimary:
+			definitions = append(definitions, "PRIMARY KEY ("+g.columnize(c.columns)+")")
+		case commandForeign:
+			definitions = append(definitions, g.foreignKey(c.foreign))
+		case commandIndex, commandUnique:
+			statements = append(statements, g.index(b.table, c))
+		default:
+			return nil, fmt.Errorf("schema: cannot %s while creating table %s", c.kind, b.table)
+		}
+	}
+
+	create := fmt.Sprintf("CREATE TABLE %s (%s)", g.quote(b.table), strings.Join(definitions, ", "))
+	return append([]string{create}, statements...), nil
+}
+
+func (g grammar) compileAlter(b *Blueprint) ([]string, error) {
+	// SQLite can only add a foreign key together with its column
+	inline := make(map[string]*ForeignKey)
+	if g.dialect == "sqlite" {
+		for _, c := range b.commands {
+			if c.kind == commandForeign && len(c.foreign.columns) == 1 {
+				inline[c.foreign.columns[0]] = c.foreign
+			}
+		}
+	}
+
+	var statements []string
+	for _, column := range b.columns {
+		if g.dialect == "sqlite" {
+			if err := sqliteCanAdd(column); err != nil {
+				return nil, fmt.Errorf("schema: sqlite cannot add column %s to table %s: %w", column.name, b.table, err)
+			}
+		}
+		definition := g.column(column)
+		if key, ok := inline[column.name]; ok {
+			definition += " " + g.references(key)
+		}
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", g.quote(b.table), definition))
+	}
+
+	table := g.quote(b.table)
+	for _, c := range b.commands {
+		switch c.kind {
+		case commandIndex, commandUnique:
+			statements = append(statements, g.index(b.table, c))
+		case commandPrimary:
+			if g.dialect == "sqlite" {
+				return nil, fmt.Errorf("schema: sqlite cannot add a primary key to table %s", b.table)
+			}
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", table, g.columnize(c.columns)))
+		case commandForeign:
+			if g.dialect != "sqlite" {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD %s", table, g.foreignKey(c.foreign)))
+			} else if len(c.foreign.columns) != 1 || !b.adds(c.foreign.columns[0]) {
+				return nil, fmt.Errorf("schema: sqlite can only add foreign key %s with a new column", c.foreign.name)
+			}
+		case commandDropColumn:
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, g.quote(c.name)))
+		case commandRenameColumn:
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, g.quote(c.name), g.quote(c.to)))
+		case commandDropIndex:
+			if g.dialect == "mysql" {
+				statements = append(statements, fmt.Sprintf("DROP INDEX %s ON %s", g.quote(c.name), table))
+			} else {
+				statements = append(statements, "DROP INDEX "+g.quote(c.name))
+			}
+		case commandDropForeign:
+			switch g.dialect {
+			case "mysql":
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", table, g.quote(c.name)))
+			case "postgres":
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, g.quote(c.name)))
+			default:
+				return nil, fmt.Errorf("schema: sqlite cannot drop foreign key %s", c.name)
+			}
+		}
+	}
+	return statements, nil
+}
+
+// sqliteCanAdd reports why SQLite would refuse to add the column to a
+// table: it needs a value for existing rows, and that value must be a
+// constant
+func sqliteCanAdd(c *Column) error {
+	if c.autoIncrement {
+		return fmt.Errorf("it is a primary key")
+	}
+	if !c.nullable && (!c.hasDefault || c.defaultValue == nil) {
+		return fmt.Errorf("it is NOT NULL without a default")
+	}
+	if _, ok := c.defaultValue.(Raw); ok {
+		return fmt.Errorf("its default %s is not a constant", c.defaultValue)
+	}
+	return nil
+}
+
+func (g grammar) compileDrop(table string, ifExists bool) string {
+	if ifExists {
+		return "DROP TABLE IF EXISTS " + g.quote(table)
+	}
+	return "DROP TABLE " + g.quote(table)
+}
+
+func (g grammar) compileRename(from, to string) string {
+	if g.dialect == "mysql" {
+		return fmt.Sprintf("RENAME TABLE %s TO %s", g.quote(from), g.quote(to))
+	}
+	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s", g.quote(from), g.quote(to))
+}
+
+// column returns a column definition
+func (g grammar) column(c *Column) string {
+	if c.autoIncrement {
+		switch g.dialect {
+		case "mysql":
+			return g.quote(c.name) + " BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY"
+		case "postgres":
+			return g.quote(c.name) + " BIGSERIAL PRIMARY KEY"
+		default:
+			// Only this exact form makes SQLite assign row ids
+			return g.quote(c.name) + " INTEGER PRIMARY KEY AUTOINCREMENT"
+		}
+	}
+
+	definition := g.quote(c.name) + " " + g.typeOf(c)
+	if c.nullable {
+		definition += " NULL"
+	} else {
+		definition += " NOT NULL"
+	}
+	if c.hasDefault {
+		definition += " DEFAULT " + g.value(c.defaultValue)
+	}
+	return definition
+}
+
+func (g grammar) typeOf(c *Column) string {
+	unsigned := ""
+	if c.unsigned && g.dialect == "mysql" {
+		unsigned = " UNSIGNED"
+	}
+
+	switch c.kind {
+	case kindString:
+		return fmt.Sprintf("VARCHAR(%d)", c.length)
+	case kindText:
+		return "TEXT"
+	case kindInteger:
+		if g.dialect == "mysql" {
+			return "INT" + unsigned
+		}
+		return "INTEGER"
+	case kindBigInteger:
+		return "BIGINT" + unsigned
+	case kindBoolean:
+		if g.dialect == "mysql" {
+			return "TINYINT(1)"
+		}
+		return "BOOLEAN"
+	case kindDecimal:
+		return fmt.Sprintf("DECIMAL(%d, %d)", c.precision, c.scale)
+	case kindDouble:
+		switch g.dialect {
+		case "mysql":
+			return "DOUBLE"
+		case "postgres":
+			return "DOUBLE PRECISION"
+		default:
+			return "REAL"
+		}
+	case kindDate:
+		return "DATE"
+	case kindDateTime:
+		if g.dialect == "postgres" {
+			return "TIMESTAMP"
+		}
+		return "DATETIME"
+	case kindTimestamp:
+		switch g.dialect {
+		case "mysql":
+			return "TIMESTAMP"
+		case "postgres":
+			return "TIMESTAMPTZ"
+		default:
+			return "DATETIME"
+		}
+	case kindJSON:
+		switch g.dialect {
+		case "mysql":
+			return "JSON"
+		case "postgres":
+			return "JSONB"
+		default:
+			return "TEXT"
+		}
+	case kindUUID:
+		switch g.dialect {
+		case "mysql":
+			return "CHAR(36)"
+		case "postgres":
+			return "UUID"
+		default:
+			return "VARCHAR(36)"
+		}
+	}
+	return strings.ToUpper(c.kind)
+}
+
+func (g grammar) index(table string, c *command) string {
+	unique := ""
+	if c.kind == commandUnique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, g.quote(c.name), g.quote(table), g.columnize(c.columns))
+}
+
+func (g grammar) foreignKey(f *ForeignKey) string {
+	return fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) %s", g.quote(f.name), g.columnize(f.columns), g.references(f))
+}
+
+func (g grammar) references(f *ForeignKey) string {
+	sql := fmt.Sprintf("REFERENCES %s (%s)", g.quote(f.on), g.columnize(f.references))
+	if f.onDelete != "" {
+		sql += " ON DELETE " + f.onDelete
+	}
+	if f.onUpdate != "" {
+		sql += " ON UPDATE " + f.onUpdate
+	}
+	return sql
+}
+
+func (g grammar) value(value interface{}) string {
+	switch v := value.(type) {
+	case Raw:
+		return string(v)
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case nil:
+		return "NULL"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (g grammar) columnize(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = g.quote(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (g grammar) quote(name string) string {
+	if g.dialect == "mysql" {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
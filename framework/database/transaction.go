@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// txKey is the context key for the ambient transaction
+type txKey struct{}
+
+// transaction is an open transaction carried in a context. Transactions on
+// other connections that were already open are reachable through outer.
+type transaction struct {
+	tx    *gorm.DB
+	pool  gorm.ConnPool
+	outer *transaction
+
+	depth int
+	hooks []func()
+	mutex sync.Mutex
+}
+
+// Transaction runs fn in a transaction on the named connection, or the
+// default one. It commits when fn returns nil and rolls back when fn
+// returns an error or panics.
+//
+// tx carries a context holding the transaction; code that is given that
+// context (tx.Statement.Context) joins the transaction through Tx,
+// Model.WithContext and QueryBuilder.WithContext, and a nested Transaction
+// call becomes a savepoint that only rolls back its own work.
+func (dm *DatabaseManager) Transaction(ctx context.Context, fn func(tx *gorm.DB) error, conn ...string) error {
+	db, err := dm.Connection(conn...)
+	if err != nil {
+		return err
+	}
+
+	if current := ambient(ctx, db); current != nil {
+		return current.savepoint(fn)
+	}
+	return begin(ctx, db, fn)
+}
+
+func begin(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	outer, _ := ctx.Value(txKey{}).(*transaction)
+	t := &transaction{pool: db.Statement.ConnPool, outer: outer}
+	t.tx = tx.WithContext(context.WithValue(ctx, txKey{}, t))
+
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		r := recover()
+		tx.Rollback()
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	if err = fn(t.tx); err != nil {
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	committed = true
+
+	for _, hook := range t.takeHooks() {
+		hook()
+	}
+	return nil
+}
+
+// savepoint runs fn in a savepoint of the transaction. Work and after-commit
+// hooks from fn are discarded if it fails.
+func (t *transaction) savepoint(fn func(tx *gorm.DB) error) (err error) {
+	t.mutex.Lock()
+	t.depth++
+	name := fmt.Sprintf("sp%d", t.depth)
+	hooks := len(t.hooks)
+	t.mutex.Unlock()
+
+	defer func() {
+		t.mutex.Lock()
+		t.depth--
+		t.mutex.Unlock()
+	}()
+
+	if err := t.tx.SavePoint(name).Error; err != nil {
+		return err
+	}
+
+	succeeded := false
+	defer func() {
+		if succeeded {
+			return
+		}
+		// Runs on panic too; the outer transaction then rolls back anyway
+		t.tx.RollbackTo(name)
+		t.mutex.Lock()
+		t.hooks = t.hooks[:hooks]
+		t.mutex.Unlock()
+	}()
+
+	if err = fn(t.tx); err != nil {
+		return err
+	}
+	succeeded = true
+	return nil
+}
+
+func (t *transaction) takeHooks() []func() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	hooks := t.hooks
+	t.hooks = nil
+	return hooks
+}
+
+// ambient returns the transaction ctx carries for db's connection
+func ambient(ctx context.Context, db *gorm.DB) *transaction {
+	t, _ := ctx.Value(txKey{}).(*transaction)
+	for ; t != nil; t = t.outer {
+		if t.pool == db.Statement.ConnPool {
+			return t
+		}
+	}
+	return nil
+}
+
+// Tx returns db bound to ctx, inside the transaction ctx carries for db's
+// connection if there is one
+func Tx(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if t := ambient(ctx, db); t != nil {
+		return t.tx
+	}
+	return db.WithContext(ctx)
+}
+
+// InTransaction reports whether ctx carries an open transaction
+func InTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*transaction)
+	return ok
+}
+
+// Transactions gives InTransaction and AfterCommit to packages that take
+// them as an interface rather than importing this one
+type Transactions struct{}
+
+func (Transactions) InTransaction(ctx context.Context) bool {
+	return InTransaction(ctx)
+}
+
+func (Transactions) AfterCommit(ctx context.Context, fn func()) {
+	AfterCommit(ctx, fn)
+}
+
+// AfterCommit runs fn once the transaction ctx carries has committed, or
+// right away when there is none. If the transaction or the savepoint fn was
+// registered in rolls back, fn never runs.
+func AfterCommit(ctx context.Context, fn func()) {
+	t, ok := ctx.Value(txKey{}).(*transaction)
+	if !ok {
+		fn()
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.hooks = append(t.hooks, fn)
+}
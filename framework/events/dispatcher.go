@@ -1,6 +1,7 @@
 package events
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"reflect"
@@ -39,10 +40,19 @@ func (f ListenerFunc) Handle(event Event) error {
 	return f(event)
 }
 
+// Transactions defers work until the database transaction a context
+// carries has committed. database.Transactions implements it.
+type Transactions interface {
+	InTransaction(ctx context.Context) bool
+	AfterCommit(ctx context.Context, fn func())
+}
+
 // EventDispatcher manages events and listeners
 type EventDispatcher struct {
-	listeners map[string][]Listener
-	mutex     sync.RWMutex
+	listeners    map[string][]Listener
+	transactions Transactions
+	mutex        sync.RWMutex
+	pending      sync.WaitGroup
 }
 
 // NewEventDispatcher creates a new event dispatcher
@@ -87,15 +97,63 @@ func (ed *EventDispatcher) Dispatch(event Event) error {
 	return nil
 }
 
+// SetTransactions sets how DispatchAfterCommit finds the transaction a
+// context carries
+func (ed *EventDispatcher) SetTransactions(transactions Transactions) {
+	ed.mutex.Lock()
+	defer ed.mutex.Unlock()
+	
+	ed.transactions = transactions
+}
+
+// DispatchAfterCommit dispatches an event once the database transaction ctx
+// carries has committed, or right away without a transaction or when no
+// Transactions are set. Listener errors from a deferred dispatch are logged.
+func (ed *EventDispatcher) DispatchAfterCommit(ctx context.Context, event Event) error {
+	ed.mutex.RLock()
+	transactions := ed.transactions
+	ed.mutex.RUnlock()
+	
+	if transactions == nil || !transactions.InTransaction(ctx) {
+		return ed.Dispatch(event)
+	}
+	
+	transactions.AfterCommit(ctx, func() {
+		if err := ed.Dispatch(event); err != nil {
+			log.Printf("After commit event dispatch error: %v", err)
+		}
+	})
+	return nil
+}
+
 // DispatchAsync dispatches an event asynchronously
 func (ed *EventDispatcher) DispatchAsync(event Event) {
+	ed.pending.Add(1)
 	go func() {
+		defer ed.pending.Done()
 		if err := ed.Dispatch(event); err != nil {
 			log.Printf("Async event dispatch error: %v", err)
 		}
 	}()
 }
 
+// Wait blocks until all asynchronous dispatches have finished or the
+// context is done
+func (ed *EventDispatcher) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ed.pending.Wait()
+		close(done)
+	}()
+	
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for async events: %w", ctx.Err())
+	}
+}
+
 func (ed *EventDispatcher) handleListener(listener Listener, event Event) error {
 	defer func() {
 		if r := recover(); r != nil {
@@ -2,6 +2,8 @@ package framework
 
 import (
 	"context"
+	goerrors "errors"
+	"fmt"
 	"github.com/test/myapp/config"
 	"github.com/test/myapp/framework/cache"
 	"github.com/test/myapp/framework/container"
@@ -11,14 +13,17 @@ import (
 	"github.com/test/myapp/framework/events"
 	"github.com/test/myapp/framework/middleware"
 	"github.com/test/myapp/framework/queue"
+	"github.com/test/myapp/framework/schedule"
 	"github.com/test/myapp/framework/validation"
 	"log"
+	"net"
+	"strings"
+	"sync"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
-	"github.com/redis/go-redis/v9"
 )
 
 // Golara represents the main framework instance
@@ -28,14 +33,22 @@ type Golara struct {
 	DB         *database.DatabaseManager
 	Cache      *cache.CacheManager
 	Queue      *queue.QueueManager
+	Schedule   *schedule.Schedule
 	Events     *events.EventDispatcher
 	Middleware *middleware.MiddlewareRegistry
 	Docs       *docs.DocGenerator
 	Validator  *validation.Validator
+
+	databaseConfig *config.DatabaseConfig
+	redisConfig    *config.RedisConfig
+	redis          map[string]redisConnection
+	redisMutex     sync.Mutex
 }
 
-// New creates a new Golara framework instance
-func New(config ...Config) *Golara {
+// New creates a new Golara framework instance. Cache stores and queue
+// connections are built from configuration, and an error is returned if
+// one is misconfigured or its Redis server cannot be reached.
+func New(config ...Config) (*Golara, error) {
 	cfg := defaultConfig()
 	if len(config) > 0 {
 		cfg = config[0]
@@ -52,6 +65,7 @@ func New(config ...Config) *Golara {
 	cacheManager := cache.NewCacheManager()
 	queueManager := queue.NewQueueManager()
 	eventsDispatcher := events.NewEventDispatcher()
+	eventsDispatcher.SetTransactions(database.Transactions{})
 	middlewareRegistry := middleware.NewMiddlewareRegistry()
 	docGenerator := docs.NewDocGenerator(cfg.AppName, cfg.Version)
 	validator := validation.NewValidator()
@@ -62,20 +76,28 @@ func New(config ...Config) *Golara {
 		DB:         dbManager,
 		Cache:      cacheManager,
 		Queue:      queueManager,
+		Schedule:   schedule.New(queueManager),
 		Events:     eventsDispatcher,
 		Middleware: middlewareRegistry,
 		Docs:       docGenerator,
 		Validator:  validator,
+		redis:      make(map[string]redisConnection),
 	}
 
-	golara.setupServices()
+	if err := golara.setupServices(cfg); err != nil {
+		golara.Cache.Close()
+		golara.closeRedis()
+		return nil, err
+	}
 	golara.setupDefaultMiddleware()
 	golara.setupDocumentation()
 
-	return golara
+	return golara, nil
 }
 
-// Config holds framework configuration
+// Config holds framework configuration. Nil Database, Cache, Queue and
+// Redis settings are loaded from the environment; RedisAddr, RedisPass and
+// RedisDB override the "default" Redis connection when set.
 type Config struct {
 	AppName     string
 	Version     string
@@ -85,6 +107,11 @@ type Config struct {
 	RedisPass   string
 	RedisDB     int
 	Environment string
+	
+	Database *config.DatabaseConfig
+	Cache    *config.CacheConfig
+	Queue    *config.QueueConfig
+	Redis    *config.RedisConfig
 }
 
 func defaultConfig() Config {
@@ -93,52 +120,92 @@ func defaultConfig() Config {
 		Version:     "1.0.0",
 		BodyLimit:   20 * 1024 * 1024, // 20MB
 		Debug:       true,
-		RedisAddr:   "localhost:6379",
-		RedisPass:   "",
-		RedisDB:     0,
 		Environment: "development",
 	}
 }
 
-func (g *Golara) setupServices() {
-	// Setup memory cache (Redis optional)
-	memoryCache := cache.NewMemoryCache("golara")
-	g.Cache.AddStore("memory", memoryCache)
-
-	// Setup default memory queue
-	memoryQueue := &queue.MemoryQueue{}
-	g.Queue.AddQueue("default", memoryQueue)
-
-	// Try Redis setup (optional)
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "",
-		DB:       0,
-	})
-
-	// Test Redis connection
-	ctx := context.Background()
-	if err := redisClient.Ping(ctx).Err(); err == nil {
-		redisCache := cache.NewRedisCache("localhost:6379", "", 0, "golara")
-		g.Cache.AddStore("redis", redisCache)
+func (g *Golara) setupServices(cfg Config) error {
+	cacheConfig := cfg.Cache
+	if cacheConfig == nil {
+		cacheConfig = config.LoadCacheConfig()
+	}
+	queueConfig := cfg.Queue
+	if queueConfig == nil {
+		queueConfig = config.LoadQueueConfig()
+	}
+	g.redisConfig = redisConfigFor(cfg)
+	g.databaseConfig = cfg.Database
+	if g.databaseConfig == nil {
+		g.databaseConfig = config.LoadDatabaseConfig()
+	}
+	
+	// Databases connect on first use, or in ConnectDatabases
+	if err := g.registerDatabases(); err != nil {
+		return err
+	}
 
-		// Setup Redis queue (replace default)
-		redisQueue := queue.NewRedisQueue(redisClient, "default")
-		g.Queue.AddQueue("default", redisQueue)
+	if err := g.setupCache(cacheConfig); err != nil {
+		return err
+	}
+	if err := g.setupQueue(queueConfig); err != nil {
+		return err
+	}
+	g.Queue.SetEventDispatcher(g.Events)
+	
+	// Fail now rather than on the first request
+	if err := g.pingRedis(); err != nil {
+		return err
 	}
+	
+	// Scheduler locks live in the default store, so they are shared between
+	// servers when it is backed by Redis
+	g.Schedule.SetLockStore(g.Cache.Store())
 
 	// Register services in container
 	g.Container.Instance("app", g.App)
 	g.Container.Instance("db", g.DB)
 	g.Container.Instance("cache", g.Cache)
 	g.Container.Instance("queue", g.Queue)
+	g.Container.Instance("schedule", g.Schedule)
 	g.Container.Instance("events", g.Events)
 	g.Container.Instance("validator", g.Validator)
+	return nil
+}
+
+// redisConfigFor returns the Redis connections with the "default" one
+// overridden by RedisAddr, RedisPass and RedisDB
+func redisConfigFor(cfg Config) *config.RedisConfig {
+	base := cfg.Redis
+	if base == nil {
+		base = config.LoadRedisConfig()
+	}
+	if cfg.RedisAddr == "" {
+		return base
+	}
+	
+	connections := make(map[string]config.RedisConnection, len(base.Connections)+1)
+	for name, conn := range base.Connections {
+		connections[name] = conn
+	}
+	host, port, err := net.SplitHostPort(cfg.RedisAddr)
+	if err != nil {
+		host, port = cfg.RedisAddr, "6379"
+	}
+	connections["default"] = config.RedisConnection{
+		Host:     host,
+		Port:     port,
+		Password: cfg.RedisPass,
+		Database: cfg.RedisDB,
+	}
+	return &config.RedisConfig{Connections: connections}
 }
 
 func (g *Golara) setupDefaultMiddleware() {
 	// Request ID middleware
 	g.App.Use(middleware.RequestID())
+	
+	// Reads after a write in the same request see it
+	g.App.Use(middleware.StickyDatabase())
 
 	// Logger middleware
 	g.App.Use(logger.New(logger.Config{
@@ -186,6 +253,12 @@ func (g *Golara) Group(prefix string, middleware ...fiber.Handler) fiber.Router
 	return g.App.Group(prefix, middleware...)
 }
 
+// ConnectDatabases opens every configured database connection, retrying
+// those that are down with exponential backoff until ctx is done
+func (g *Golara) ConnectDatabases(ctx context.Context) error {
+	return g.DB.WaitForConnections(ctx)
+}
+
 // ConnectDatabase connects to database
 func (g *Golara) ConnectDatabase(name string, config database.DatabaseConfig) error {
 	return g.DB.Connect(name, config)
@@ -196,18 +269,69 @@ func (g *Golara) StartQueue(queueName string, concurrency int) {
 	g.Queue.StartWorker(queueName, concurrency)
 }
 
+// QueueStatusHandler returns a handler that reports queue sizes and job
+// metrics as JSON
+func (g *Golara) QueueStatusHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		queues, err := g.Queue.Status()
+		if err != nil {
+			return err
+		}
+		
+		return c.JSON(fiber.Map{
+			"queues":  queues,
+			"metrics": g.Queue.Metrics().Snapshot(),
+		})
+	}
+}
+
+// DatabaseHealthHandler returns a handler that reports the state of each
+// database connection as JSON, with status 503 when one is down
+func (g *Golara) DatabaseHealthHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report := g.DB.Health()
+		
+		status := fiber.StatusOK
+		for _, health := range report {
+			if !health.Healthy {
+				status = fiber.StatusServiceUnavailable
+			}
+		}
+		return c.Status(status).JSON(fiber.Map{"databases": report})
+	}
+}
+
 // Listen starts the server
 func (g *Golara) Listen(addr string) error {
 	log.Printf("🚀 Golara server starting on %s", addr)
 	log.Printf("📚 API Documentation available at http://localhost%s/docs", addr)
-	log.Printf("🗄️  Database connections: %v", g.DB)
-	log.Printf("💾 Cache stores available: redis, memory")
+	log.Printf("🗄️  Database connections: %s", strings.Join(g.DB.Names(), ", "))
+	log.Printf("💾 Cache stores available: %s", strings.Join(g.Cache.Names(), ", "))
 	log.Printf("⚡ Queue workers ready")
 	return g.App.Listen(addr)
 }
 
-// Shutdown gracefully shuts down the server
-func (g *Golara) Shutdown() error {
+// Shutdown gracefully shuts down the server. It stops accepting HTTP
+// requests, drains queue workers and async events, then closes database
+// and Redis connections and the cache stores. Steps that hit the context
+// deadline are reported in the returned error; later steps still run.
+func (g *Golara) Shutdown(ctx context.Context) error {
 	log.Println("🛑 Shutting down Golara server...")
-	return g.App.Shutdown()
+
+	var errs []error
+	record := func(step string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", step, err))
+		}
+	}
+
+	record("http server", g.App.ShutdownWithContext(ctx))
+	record("queue workers", g.Queue.Shutdown(ctx))
+	record("events", g.Events.Wait(ctx))
+	record("database", g.DB.Close())
+
+	record("cache", g.Cache.Close())
+	record("redis", g.closeRedis())
+
+	return goerrors.Join(errs...)
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/test/myapp/framework/database"
 )
 
 // MiddlewareRegistry manages middleware registration and execution
@@ -61,6 +62,16 @@ func RequestID() fiber.Handler {
 	}
 }
 
+// StickyDatabase gives each request a sticky database context, so reads
+// made with c.UserContext() after a write go to the primary on connections
+// with Sticky set
+func StickyDatabase() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(database.StickyContext(c.UserContext()))
+		return c.Next()
+	}
+}
+
 // RateLimiter implements basic rate limiting
 func RateLimiter(maxRequests int, window time.Duration) fiber.Handler {
 	requests := make(map[string][]time.Time)
@@ -0,0 +1,541 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Batch tracks the progress of a group of jobs dispatched together
+type Batch struct {
+	ID          string     `json:"id"`
+	TotalJobs   int        `json:"total_jobs"`
+	PendingJobs int        `json:"pending_jobs"`
+	FailedJobs  int        `json:"failed_jobs"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+}
+
+// Finished reports whether every job in the batch has run
+func (b *Batch) Finished() bool {
+	return b.PendingJobs <= 0
+}
+
+// Cancelled reports whether the batch was cancelled
+func (b *Batch) Cancelled() bool {
+	return b.CancelledAt != nil
+}
+
+// Progress returns the percentage of jobs that have run
+func (b *Batch) Progress() int {
+	if b.TotalJobs == 0 {
+		return 100
+	}
+	return (b.TotalJobs - b.PendingJobs) * 100 / b.TotalJobs
+}
+
+// BatchRepository persists batch progress counters
+type BatchRepository interface {
+	Store(batch *Batch) error
+	Find(id string) (*Batch, error)
+	// RecordJob marks one job of the batch as finished and returns the
+	// updated batch
+	RecordJob(id string, failed bool) (*Batch, error)
+	Cancel(id string) error
+	Delete(id string) error
+}
+
+// ErrBatchNotFound indicates an unknown batch ID
+var ErrBatchNotFound = fmt.Errorf("batch not found")
+
+// DefaultBatchTTL is how long a batch is kept after its last update, so
+// finished and abandoned batches do not pile up
+const DefaultBatchTTL = 24 * time.Hour
+
+// batchCallbacks holds the callbacks of a batch dispatched by this process
+type batchCallbacks struct {
+	then    []func(*Batch)
+	catch   []func(*Batch, error)
+	finally []func(*Batch)
+}
+
+// PendingBatch collects jobs and callbacks before a batch is dispatched
+type PendingBatch struct {
+	manager   *QueueManager
+	jobs      []Job
+	callbacks batchCallbacks
+}
+
+// Batch starts a batch of jobs that run in parallel. Callbacks run in the
+// process that dispatched the batch, so workers must share it.
+func (qm *QueueManager) Batch(jobs ...Job) *PendingBatch {
+	return &PendingBatch{manager: qm, jobs: jobs}
+}
+
+// Then registers a callback for when every job succeeded
+func (pb *PendingBatch) Then(callback func(*Batch)) *PendingBatch {
+	pb.callbacks.then = append(pb.callbacks.then, callback)
+	return pb
+}
+
+// Catch registers a callback for the first job that fails
+func (pb *PendingBatch) Catch(callback func(*Batch, error)) *PendingBatch {
+	pb.callbacks.catch = append(pb.callbacks.catch, callback)
+	return pb
+}
+
+// Finally registers a callback for when every job has run, failed or not
+func (pb *PendingBatch) Finally(callback func(*Batch)) *PendingBatch {
+	pb.callbacks.finally = append(pb.callbacks.finally, callback)
+	return pb
+}
+
+// Dispatch stores the batch and pushes its jobs
+func (pb *PendingBatch) Dispatch(queueName ...string) (*Batch, error) {
+	qm := pb.manager
+	queue := qm.Queue(queueName...)
+	if queue == nil {
+		return nil, fmt.Errorf("queue not found")
+	}
+
+	batch := &Batch{
+		ID:          uuid.NewString(),
+		TotalJobs:   len(pb.jobs),
+		PendingJobs: len(pb.jobs),
+		CreatedAt:   time.Now(),
+	}
+
+	repository := qm.batchRepository()
+	if err := repository.Store(batch); err != nil {
+		return nil, err
+	}
+
+	qm.mutex.Lock()
+	qm.batchCallbacks[batch.ID] = &pb.callbacks
+	qm.mutex.Unlock()
+
+	if len(pb.jobs) == 0 {
+		qm.finishBatch(batch, nil, false)
+		return batch, nil
+	}
+
+	for i, job := range pb.jobs {
+		queued, err := toQueuedJob(job)
+		if err == nil {
+			queued.batchID = batch.ID
+			err = qm.pushAs(context.Background(), queue, job, queued)
+		}
+		if err != nil {
+			qm.abandonBatch(batch.ID, i > 0)
+			return batch, fmt.Errorf("failed to dispatch batch %s: %w", batch.ID, err)
+		}
+	}
+
+	return batch, nil
+}
+
+// abandonBatch drops the callbacks of a batch that failed to dispatch. A
+// batch with jobs already queued is cancelled so they are skipped; it
+// expires with the repository's TTL.
+func (qm *QueueManager) abandonBatch(id string, queued bool) {
+	qm.mutex.Lock()
+	delete(qm.batchCallbacks, id)
+	qm.mutex.Unlock()
+
+	repository := qm.batchRepository()
+	cleanUp := repository.Delete
+	if queued {
+		cleanUp = repository.Cancel
+	}
+	if err := cleanUp(id); err != nil {
+		log.Printf("Failed to clean up batch %s: %v", id, err)
+	}
+}
+
+// FindBatch returns a batch by ID
+func (qm *QueueManager) FindBatch(id string) (*Batch, error) {
+	return qm.batchRepository().Find(id)
+}
+
+// CancelBatch cancels a batch. Jobs of a cancelled batch that have not
+// started yet are skipped.
+func (qm *QueueManager) CancelBatch(id string) error {
+	return qm.batchRepository().Cancel(id)
+}
+
+// SetBatchRepository sets where batch progress is persisted
+func (qm *QueueManager) SetBatchRepository(repository BatchRepository) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	qm.batches = repository
+}
+
+func (qm *QueueManager) batchRepository() BatchRepository {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+	return qm.batches
+}
+
+// recordBatchJob updates the batch of a finished job and fires callbacks
+func (qm *QueueManager) recordBatchJob(batchID string, jobErr error) {
+	batch, err := qm.batchRepository().RecordJob(batchID, jobErr != nil)
+	if err != nil {
+		log.Printf("Failed to record job for batch %s: %v", batchID, err)
+		return
+	}
+
+	qm.finishBatch(batch, jobErr, jobErr != nil && batch.FailedJobs == 1)
+}
+
+func (qm *QueueManager) finishBatch(batch *Batch, jobErr error, firstFailure bool) {
+	qm.mutex.Lock()
+	callbacks, exists := qm.batchCallbacks[batch.ID]
+	if exists && batch.Finished() {
+		delete(qm.batchCallbacks, batch.ID)
+	}
+	qm.mutex.Unlock()
+
+	if !exists {
+		return
+	}
+
+	if firstFailure {
+		for _, callback := range callbacks.catch {
+			callback(batch, jobErr)
+		}
+	}
+
+	if !batch.Finished() {
+		return
+	}
+
+	if batch.FailedJobs == 0 && !batch.Cancelled() {
+		for _, callback := range callbacks.then {
+			callback(batch)
+		}
+	}
+	for _, callback := range callbacks.finally {
+		callback(batch)
+	}
+}
+
+// PendingChain collects jobs that run one after another
+type PendingChain struct {
+	manager *QueueManager
+	jobs    []Job
+}
+
+// Chain starts a chain of jobs. Each job is queued once the previous one
+// succeeded; the chain stops at the first job that fails.
+func (qm *QueueManager) Chain(jobs ...Job) *PendingChain {
+	return &PendingChain{manager: qm, jobs: jobs}
+}
+
+// Dispatch pushes the first job, carrying the rest of the chain with it
+func (pc *PendingChain) Dispatch(queueName ...string) error {
+	if len(pc.jobs) == 0 {
+		return nil
+	}
+
+	queue := pc.manager.Queue(queueName...)
+	if queue == nil {
+		return fmt.Errorf("queue not found")
+	}
+
+	first, err := toQueuedJob(pc.jobs[0])
+	if err != nil {
+		return err
+	}
+
+	for _, job := range pc.jobs[1:] {
+		raw, err := encodeJob(job)
+		if err != nil {
+			return err
+		}
+		first.chain = append(first.chain, raw)
+	}
+
+	return pc.manager.pushAs(context.Background(), queue, pc.jobs[0], first)
+}
+
+// dispatchNextInChain pushes the next job of a finished job's chain.
+// Workers created without a manager push it without dispatch middleware.
+func (qm *QueueManager) dispatchNextInChain(queue Queue, job Job) error {
+	bj, ok := job.(*BaseJob)
+	if !ok || len(bj.chain) == 0 {
+		return nil
+	}
+
+	next, err := decodeJob(bj.chain[0])
+	if err != nil {
+		return err
+	}
+	next.chain = bj.chain[1:]
+
+	if qm == nil {
+		return queue.Push(next)
+	}
+	return qm.push(context.Background(), queue, next)
+}
+
+// toQueuedJob converts a job into the BaseJob form a queue carries, so
+// chain and batch metadata can be attached to it
+func toQueuedJob(job Job) (*BaseJob, error) {
+	raw, err := encodeJob(job)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJob(raw)
+}
+
+// jobBatchID returns the batch a popped job belongs to
+func jobBatchID(job Job) string {
+	if bj, ok := job.(*BaseJob); ok {
+		return bj.batchID
+	}
+	return ""
+}
+
+// MemoryBatchRepository keeps batches in memory. Batches expire a TTL
+// after their last update.
+type MemoryBatchRepository struct {
+	batches map[string]memoryBatch
+	ttl     time.Duration
+	mutex   sync.Mutex
+}
+
+type memoryBatch struct {
+	batch     Batch
+	expiresAt time.Time
+}
+
+// NewMemoryBatchRepository creates a new in-memory batch repository
+func NewMemoryBatchRepository() *MemoryBatchRepository {
+	return &MemoryBatchRepository{
+		batches: make(map[string]memoryBatch),
+		ttl:     DefaultBatchTTL,
+	}
+}
+
+// SetTTL sets how long a batch is kept after its last update
+func (mr *MemoryBatchRepository) SetTTL(ttl time.Duration) {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+	mr.ttl = ttl
+}
+
+func (mr *MemoryBatchRepository) Store(batch *Batch) error {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	// Drop expired batches as new ones arrive
+	now := time.Now()
+	for id, stored := range mr.batches {
+		if now.After(stored.expiresAt) {
+			delete(mr.batches, id)
+		}
+	}
+	mr.put(*batch)
+	return nil
+}
+
+func (mr *MemoryBatchRepository) Find(id string) (*Batch, error) {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	batch, exists := mr.get(id)
+	if !exists {
+		return nil, ErrBatchNotFound
+	}
+	return &batch, nil
+}
+
+func (mr *MemoryBatchRepository) RecordJob(id string, failed bool) (*Batch, error) {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	batch, exists := mr.get(id)
+	if !exists {
+		return nil, ErrBatchNotFound
+	}
+
+	batch.PendingJobs--
+	if failed {
+		batch.FailedJobs++
+	}
+	mr.put(batch)
+	return &batch, nil
+}
+
+func (mr *MemoryBatchRepository) Cancel(id string) error {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	batch, exists := mr.get(id)
+	if !exists {
+		return ErrBatchNotFound
+	}
+
+	now := time.Now()
+	batch.CancelledAt = &now
+	mr.put(batch)
+	return nil
+}
+
+func (mr *MemoryBatchRepository) get(id string) (Batch, bool) {
+	stored, exists := mr.batches[id]
+	if !exists || time.Now().After(stored.expiresAt) {
+		return Batch{}, false
+	}
+	return stored.batch, true
+}
+
+func (mr *MemoryBatchRepository) put(batch Batch) {
+	mr.batches[batch.ID] = memoryBatch{batch: batch, expiresAt: time.Now().Add(mr.ttl)}
+}
+
+func (mr *MemoryBatchRepository) Delete(id string) error {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+	delete(mr.batches, id)
+	return nil
+}
+
+// RedisBatchRepository keeps each batch in a Redis hash, which expires a
+// TTL after the batch's last update
+type RedisBatchRepository struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisBatchRepository creates a batch repository storing hashes under prefix
+func NewRedisBatchRepository(client *redis.Client, prefix string) *RedisBatchRepository {
+	if prefix == "" {
+		prefix = "batches"
+	}
+	return &RedisBatchRepository{
+		client: client,
+		prefix: prefix,
+		ttl:    DefaultBatchTTL,
+	}
+}
+
+// SetTTL sets how long a batch is kept after its last update
+func (rr *RedisBatchRepository) SetTTL(ttl time.Duration) {
+	rr.ttl = ttl
+}
+
+// recordBatchScript updates the counters and returns the whole hash in one step
+var recordBatchScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return nil
+end
+redis.call('HINCRBY', KEYS[1], 'pending_jobs', -1)
+if ARGV[1] == '1' then
+	redis.call('HINCRBY', KEYS[1], 'failed_jobs', 1)
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return redis.call('HGETALL', KEYS[1])
+`)
+
+func (rr *RedisBatchRepository) key(id string) string {
+	return rr.prefix + ":" + id
+}
+
+func (rr *RedisBatchRepository) Store(batch *Batch) error {
+	ctx := context.Background()
+
+	pipe := rr.client.TxPipeline()
+	pipe.HSet(ctx, rr.key(batch.ID), map[string]interface{}{
+		"id":           batch.ID,
+		"total_jobs":   batch.TotalJobs,
+		"pending_jobs": batch.PendingJobs,
+		"failed_jobs":  batch.FailedJobs,
+		"created_at":   batch.CreatedAt.UnixMilli(),
+	})
+	pipe.PExpire(ctx, rr.key(batch.ID), rr.ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (rr *RedisBatchRepository) Find(id string) (*Batch, error) {
+	ctx := context.Background()
+
+	fields, err := rr.client.HGetAll(ctx, rr.key(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrBatchNotFound
+	}
+	return batchFromHash(fields), nil
+}
+
+func (rr *RedisBatchRepository) RecordJob(id string, failed bool) (*Batch, error) {
+	ctx := context.Background()
+
+	flag := "0"
+	if failed {
+		flag = "1"
+	}
+
+	result, err := recordBatchScript.Run(ctx, rr.client, []string{rr.key(id)}, flag, rr.ttl.Milliseconds()).StringSlice()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrBatchNotFound
+		}
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(result)/2)
+	for i := 0; i+1 < len(result); i += 2 {
+		fields[result[i]] = result[i+1]
+	}
+	return batchFromHash(fields), nil
+}
+
+func (rr *RedisBatchRepository) Cancel(id string) error {
+	ctx := context.Background()
+
+	exists, err := rr.client.Exists(ctx, rr.key(id)).Result()
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrBatchNotFound
+	}
+
+	pipe := rr.client.TxPipeline()
+	pipe.HSet(ctx, rr.key(id), "cancelled_at", time.Now().UnixMilli())
+	pipe.PExpire(ctx, rr.key(id), rr.ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (rr *RedisBatchRepository) Delete(id string) error {
+	ctx := context.Background()
+	return rr.client.Del(ctx, rr.key(id)).Err()
+}
+
+func batchFromHash(fields map[string]string) *Batch {
+	batch := &Batch{ID: fields["id"]}
+	batch.TotalJobs, _ = strconv.Atoi(fields["total_jobs"])
+	batch.PendingJobs, _ = strconv.Atoi(fields["pending_jobs"])
+	batch.FailedJobs, _ = strconv.Atoi(fields["failed_jobs"])
+
+	if createdAt, err := strconv.ParseInt(fields["created_at"], 10, 64); err == nil {
+		batch.CreatedAt = time.UnixMilli(createdAt)
+	}
+	if cancelledAt, err := strconv.ParseInt(fields["cancelled_at"], 10, 64); err == nil {
+		at := time.UnixMilli(cancelledAt)
+		batch.CancelledAt = &at
+	}
+	return batch
+}
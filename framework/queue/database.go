@@ -0,0 +1,408 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultJobsTable is the table DatabaseQueue stores jobs in
+const DefaultJobsTable = "jobs"
+
+// DatabaseJob is a row of the jobs table. Times are Unix milliseconds.
+// Attempts mirrors the failed attempts recorded in the payload, so they can
+// be queried. Reservation is a token written by each pop; only the worker
+// holding the current one can acknowledge or release the job.
+type DatabaseJob struct {
+	ID          uint64  `gorm:"primaryKey;autoIncrement"`
+	Queue       string  `gorm:"size:255;not null;index:idx_jobs_queue_available,priority:1"`
+	Payload     string  `gorm:"type:text;not null"`
+	Attempts    int     `gorm:"not null;default:0"`
+	Reservation *string `gorm:"size:36;index"`
+	ReservedAt  *int64
+	AvailableAt int64 `gorm:"not null;index:idx_jobs_queue_available,priority:2"`
+	CreatedAt   int64 `gorm:"not null;autoCreateTime:milli"`
+}
+
+func (DatabaseJob) TableName() string {
+	return DefaultJobsTable
+}
+
+// CreateJobsTableMigration creates the table used by DatabaseQueue. Register
+// it with a database.Migrator before using the database queue driver.
+func CreateJobsTableMigration() (string, func(*gorm.DB) error, func(*gorm.DB) error) {
+	return "2024_01_01_000002_create_jobs_table",
+		// Up
+		func(db *gorm.DB) error {
+			return db.Migrator().CreateTable(&DatabaseJob{})
+		},
+		// Down
+		func(db *gorm.DB) error {
+			return db.Migrator().DropTable(&DatabaseJob{})
+		}
+}
+
+// claimRetries bounds how often a SQLite worker retries after another
+// worker claimed the job it selected
+const claimRetries = 5
+
+// DatabaseQueue stores jobs in a database table, for deployments without
+// Redis. On MySQL 8+ and Postgres workers claim jobs with
+// SELECT ... FOR UPDATE SKIP LOCKED, so they never wait on each other. SQLite
+// has no row locks; there a job is claimed with an UPDATE that only matches
+// while it is still available.
+//
+// Reserved jobs whose visibility timeout has passed become available again.
+type DatabaseQueue struct {
+	resolve           func() (*gorm.DB, error)
+	table             string
+	queueName         string
+	visibilityTimeout time.Duration
+	timeout           time.Duration
+}
+
+// NewDatabaseQueue creates a queue stored in db
+func NewDatabaseQueue(db *gorm.DB, queueName string) *DatabaseQueue {
+	return NewLazyDatabaseQueue(func() (*gorm.DB, error) { return db, nil }, queueName)
+}
+
+// NewLazyDatabaseQueue creates a queue that resolves its connection on each
+// operation, so it can be set up before the database is connected
+func NewLazyDatabaseQueue(resolve func() (*gorm.DB, error), queueName string) *DatabaseQueue {
+	return &DatabaseQueue{
+		resolve:           resolve,
+		table:             DefaultJobsTable,
+		queueName:         queueName,
+		visibilityTimeout: DefaultVisibilityTimeout,
+		timeout:           DefaultOperationTimeout,
+	}
+}
+
+// SetTable sets the table jobs are stored in
+func (dq *DatabaseQueue) SetTable(table string) {
+	dq.table = table
+}
+
+// SetVisibilityTimeout sets how long a popped job stays reserved
+func (dq *DatabaseQueue) SetVisibilityTimeout(timeout time.Duration) {
+	dq.visibilityTimeout = timeout
+}
+
+// SetOperationTimeout bounds each operation when the caller's context has
+// no earlier deadline. Zero disables the timeout.
+func (dq *DatabaseQueue) SetOperationTimeout(timeout time.Duration) {
+	dq.timeout = timeout
+}
+
+// jobs returns a query on this queue's table that can be reused for
+// several statements
+func (dq *DatabaseQueue) jobs(ctx context.Context) (*gorm.DB, error) {
+	db, err := dq.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return nil, fmt.Errorf("database queue %s has no connection", dq.queueName)
+	}
+	return db.WithContext(ctx).Table(dq.table).Session(&gorm.Session{}), nil
+}
+
+func (dq *DatabaseQueue) Push(job Job, delay ...time.Duration) error {
+	return dq.PushCtx(context.Background(), job, delay...)
+}
+
+func (dq *DatabaseQueue) PushCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	ctx, cancel := withTimeout(ctx, dq.timeout)
+	defer cancel()
+
+	job.SetID(uuid.NewString())
+	return dq.insert(ctx, job, delay...)
+}
+
+func (dq *DatabaseQueue) insert(ctx context.Context, job Job, delay ...time.Duration) error {
+	data, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := dq.jobs(ctx)
+	if err != nil {
+		return err
+	}
+
+	return jobs.Create(&DatabaseJob{
+		Queue:       dq.queueName,
+		Payload:     string(data),
+		Attempts:    job.GetAttempts(),
+		AvailableAt: availableAt(delay...),
+	}).Error
+}
+
+func availableAt(delay ...time.Duration) int64 {
+	at := time.Now()
+	if len(delay) > 0 && delay[0] > 0 {
+		at = at.Add(delay[0])
+	}
+	return at.UnixMilli()
+}
+
+func (dq *DatabaseQueue) Pop() (Job, error) {
+	return dq.PopCtx(context.Background())
+}
+
+func (dq *DatabaseQueue) PopCtx(ctx context.Context) (Job, error) {
+	ctx, cancel := withTimeout(ctx, dq.timeout)
+	defer cancel()
+
+	jobs, err := dq.jobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token := uuid.NewString()
+	var row *DatabaseJob
+	if jobs.Dialector.Name() == "sqlite" {
+		row, err = dq.claimUpdate(jobs, token)
+	} else {
+		row, err = dq.claimLocked(jobs, token)
+	}
+	if err != nil || row == nil {
+		return nil, err
+	}
+
+	job, err := decodeJob([]byte(row.Payload))
+	if err != nil {
+		return nil, err
+	}
+	job.reservation = token
+	return job, nil
+}
+
+// available limits a query to jobs that can be reserved now: ready jobs and
+// jobs whose reservation expired
+func (dq *DatabaseQueue) available(query *gorm.DB, now time.Time) *gorm.DB {
+	expired := now.Add(-dq.visibilityTimeout).UnixMilli()
+	return query.
+		Where("queue = ?", dq.queueName).
+		Where("((reserved_at IS NULL AND available_at <= ?) OR reserved_at <= ?)", now.UnixMilli(), expired)
+}
+
+func reservation(now time.Time, token string) map[string]interface{} {
+	return map[string]interface{}{"reservation": token, "reserved_at": now.UnixMilli()}
+}
+
+// claimLocked reserves the next job under a row lock, skipping rows other
+// workers have locked
+func (dq *DatabaseQueue) claimLocked(jobs *gorm.DB, token string) (*DatabaseJob, error) {
+	var claimed *DatabaseJob
+	err := jobs.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var rows []DatabaseJob
+		err := dq.available(tx.Table(dq.table), now).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Order("id").
+			Limit(1).
+			Find(&rows).Error
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+
+		if err := tx.Table(dq.table).Where("id = ?", rows[0].ID).Updates(reservation(now, token)).Error; err != nil {
+			return err
+		}
+		claimed = &rows[0]
+		return nil
+	})
+	return claimed, err
+}
+
+// claimUpdate reserves the next job with an UPDATE that only succeeds while
+// the job is still available, retrying when another worker won the race
+func (dq *DatabaseQueue) claimUpdate(jobs *gorm.DB, token string) (*DatabaseJob, error) {
+	for i := 0; i < claimRetries; i++ {
+		now := time.Now()
+
+		var rows []DatabaseJob
+		err := dq.available(jobs, now).Order("id").Limit(1).Find(&rows).Error
+		if err != nil || len(rows) == 0 {
+			return nil, err
+		}
+
+		result := dq.available(jobs, now).
+			Where("id = ?", rows[0].ID).
+			Updates(reservation(now, token))
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return &rows[0], nil
+		}
+	}
+	return nil, nil
+}
+
+// Ack deletes a processed job
+func (dq *DatabaseQueue) Ack(job Job) error {
+	return dq.AckCtx(context.Background(), job)
+}
+
+func (dq *DatabaseQueue) AckCtx(ctx context.Context, job Job) error {
+	ctx, cancel := withTimeout(ctx, dq.timeout)
+	defer cancel()
+
+	token, ok := reservationOf(job)
+	if !ok {
+		return nil
+	}
+
+	jobs, err := dq.jobs(ctx)
+	if err != nil {
+		return err
+	}
+	return jobs.Where("reservation = ?", token).Delete(&DatabaseJob{}).Error
+}
+
+// Release returns a reserved job to the queue, optionally after a delay.
+// Jobs that are not reserved, or that a later pop reserved again, are left
+// alone.
+func (dq *DatabaseQueue) Release(job Job, delay ...time.Duration) error {
+	return dq.ReleaseCtx(context.Background(), job, delay...)
+}
+
+func (dq *DatabaseQueue) ReleaseCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	ctx, cancel := withTimeout(ctx, dq.timeout)
+	defer cancel()
+
+	token, ok := reservationOf(job)
+	if !ok {
+		return nil
+	}
+
+	data, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := dq.jobs(ctx)
+	if err != nil {
+		return err
+	}
+	return jobs.Where("reservation = ?", token).Updates(map[string]interface{}{
+		"payload":      string(data),
+		"attempts":     job.GetAttempts(),
+		"reservation":  nil,
+		"reserved_at":  nil,
+		"available_at": availableAt(delay...),
+	}).Error
+}
+
+// VisibilityTimeout returns how long a popped job stays reserved
+func (dq *DatabaseQueue) VisibilityTimeout() time.Duration {
+	return dq.visibilityTimeout
+}
+
+// Extend pushes the deadline of a job's reservation a visibility timeout
+// into the future
+func (dq *DatabaseQueue) Extend(job Job) error {
+	return dq.ExtendCtx(context.Background(), job)
+}
+
+func (dq *DatabaseQueue) ExtendCtx(ctx context.Context, job Job) error {
+	ctx, cancel := withTimeout(ctx, dq.timeout)
+	defer cancel()
+
+	token, ok := reservationOf(job)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotReserved, job.GetID())
+	}
+
+	jobs, err := dq.jobs(ctx)
+	if err != nil {
+		return err
+	}
+	result := jobs.Where("reservation = ?", token).Update("reserved_at", time.Now().UnixMilli())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrNotReserved, job.GetID())
+	}
+	return nil
+}
+
+// reservationOf returns the token of the pop that reserved job. Jobs that
+// were not popped from a DatabaseQueue have none.
+func reservationOf(job Job) (string, bool) {
+	bj, ok := job.(*BaseJob)
+	if !ok || bj.reservation == "" {
+		return "", false
+	}
+	return bj.reservation, true
+}
+
+// Size returns the number of jobs ready to run
+func (dq *DatabaseQueue) Size() (int64, error) {
+	return dq.SizeCtx(context.Background())
+}
+
+func (dq *DatabaseQueue) SizeCtx(ctx context.Context) (int64, error) {
+	stats, err := dq.stats(ctx)
+	return stats.Pending, err
+}
+
+func (dq *DatabaseQueue) Stats() (QueueStats, error) {
+	return dq.stats(context.Background())
+}
+
+func (dq *DatabaseQueue) stats(ctx context.Context) (QueueStats, error) {
+	ctx, cancel := withTimeout(ctx, dq.timeout)
+	defer cancel()
+
+	jobs, err := dq.jobs(ctx)
+	if err != nil {
+		return QueueStats{}, err
+	}
+
+	// DELAYED is reserved in MySQL, hence the aliases
+	var counts struct {
+		PendingJobs  int64
+		DelayedJobs  int64
+		ReservedJobs int64
+	}
+	now := time.Now().UnixMilli()
+	err = jobs.
+		Select(
+			"COUNT(CASE WHEN reserved_at IS NULL AND available_at <= ? THEN 1 END) AS pending_jobs, "+
+				"COUNT(CASE WHEN reserved_at IS NULL AND available_at > ? THEN 1 END) AS delayed_jobs, "+
+				"COUNT(reserved_at) AS reserved_jobs",
+			now, now,
+		).
+		Where("queue = ?", dq.queueName).
+		Scan(&counts).Error
+
+	return QueueStats{
+		Pending:  counts.PendingJobs,
+		Delayed:  counts.DelayedJobs,
+		Reserved: counts.ReservedJobs,
+	}, err
+}
+
+func (dq *DatabaseQueue) Clear() error {
+	return dq.ClearCtx(context.Background())
+}
+
+func (dq *DatabaseQueue) ClearCtx(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, dq.timeout)
+	defer cancel()
+
+	jobs, err := dq.jobs(ctx)
+	if err != nil {
+		return err
+	}
+	return jobs.Where("queue = ?", dq.queueName).Delete(&DatabaseJob{}).Error
+}
@@ -0,0 +1,266 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// FailedJob is a job that exhausted all of its attempts
+type FailedJob struct {
+	ID        string                 `json:"id"`
+	Queue     string                 `json:"queue"`
+	Name      string                 `json:"name"`
+	Payload   map[string]interface{} `json:"payload"`
+	Job       json.RawMessage        `json:"job,omitempty"`
+	Attempts  int                    `json:"attempts"`
+	Exception string                 `json:"exception"`
+	FailedAt  time.Time              `json:"failed_at"`
+}
+
+// FailedJobStore persists jobs that could not be processed
+type FailedJobStore interface {
+	Log(job FailedJob) error
+	All() ([]FailedJob, error)
+	Find(id string) (*FailedJob, error)
+	Forget(id string) error
+	Flush() error
+}
+
+// ErrFailedJobNotFound indicates an unknown failed job ID
+var ErrFailedJobNotFound = fmt.Errorf("failed job not found")
+
+// SetFailedJobStore sets the store used to record failed jobs
+func (qm *QueueManager) SetFailedJobStore(store FailedJobStore) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	qm.failed = store
+}
+
+// SetRetryPolicy sets the default retry policy for new workers
+func (qm *QueueManager) SetRetryPolicy(policy RetryPolicy) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	qm.retry = policy
+}
+
+// FailedJobs returns all recorded failed jobs, newest first
+func (qm *QueueManager) FailedJobs() ([]FailedJob, error) {
+	return qm.failedStore().All()
+}
+
+// RetryFailedJob pushes a failed job back onto its queue and forgets it
+func (qm *QueueManager) RetryFailedJob(id string) error {
+	store := qm.failedStore()
+
+	failedJob, err := store.Find(id)
+	if err != nil {
+		return err
+	}
+
+	queue := qm.Queue(failedJob.Queue)
+	if queue == nil {
+		queue = qm.Queue()
+	}
+	if queue == nil {
+		return fmt.Errorf("no queue available to retry job %s", id)
+	}
+
+	job := &BaseJob{
+		Name:    failedJob.Name,
+		Payload: failedJob.Payload,
+	}
+	if len(failedJob.Job) > 0 {
+		if job, err = decodeJob(failedJob.Job); err != nil {
+			return err
+		}
+		job.Attempts = 0
+	}
+	if err := queue.Push(job); err != nil {
+		return err
+	}
+
+	return store.Forget(id)
+}
+
+// ForgetFailedJob deletes a failed job
+func (qm *QueueManager) ForgetFailedJob(id string) error {
+	return qm.failedStore().Forget(id)
+}
+
+// FlushFailedJobs deletes all failed jobs
+func (qm *QueueManager) FlushFailedJobs() error {
+	return qm.failedStore().Flush()
+}
+
+func (qm *QueueManager) failedStore() FailedJobStore {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+	return qm.failed
+}
+
+// MemoryFailedJobStore keeps failed jobs in memory
+type MemoryFailedJobStore struct {
+	jobs  map[string]FailedJob
+	mutex sync.RWMutex
+}
+
+// NewMemoryFailedJobStore creates a new in-memory failed job store
+func NewMemoryFailedJobStore() *MemoryFailedJobStore {
+	return &MemoryFailedJobStore{
+		jobs: make(map[string]FailedJob),
+	}
+}
+
+func (ms *MemoryFailedJobStore) Log(job FailedJob) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if job.ID == "" {
+		job.ID = uuid.NewString()
+	}
+	ms.jobs[job.ID] = job
+	return nil
+}
+
+func (ms *MemoryFailedJobStore) All() ([]FailedJob, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	jobs := make([]FailedJob, 0, len(ms.jobs))
+	for _, job := range ms.jobs {
+		jobs = append(jobs, job)
+	}
+	sortFailedJobs(jobs)
+	return jobs, nil
+}
+
+func (ms *MemoryFailedJobStore) Find(id string) (*FailedJob, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	job, exists := ms.jobs[id]
+	if !exists {
+		return nil, ErrFailedJobNotFound
+	}
+	return &job, nil
+}
+
+func (ms *MemoryFailedJobStore) Forget(id string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if _, exists := ms.jobs[id]; !exists {
+		return ErrFailedJobNotFound
+	}
+	delete(ms.jobs, id)
+	return nil
+}
+
+func (ms *MemoryFailedJobStore) Flush() error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.jobs = make(map[string]FailedJob)
+	return nil
+}
+
+// RedisFailedJobStore keeps failed jobs in a Redis hash
+type RedisFailedJobStore struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisFailedJobStore creates a failed job store under the given hash key
+func NewRedisFailedJobStore(client *redis.Client, key string) *RedisFailedJobStore {
+	if key == "" {
+		key = "failed_jobs"
+	}
+	return &RedisFailedJobStore{
+		client: client,
+		key:    key,
+	}
+}
+
+func (rs *RedisFailedJobStore) Log(job FailedJob) error {
+	ctx := context.Background()
+
+	if job.ID == "" {
+		job.ID = uuid.NewString()
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return rs.client.HSet(ctx, rs.key, job.ID, data).Err()
+}
+
+func (rs *RedisFailedJobStore) All() ([]FailedJob, error) {
+	ctx := context.Background()
+
+	entries, err := rs.client.HGetAll(ctx, rs.key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]FailedJob, 0, len(entries))
+	for _, data := range entries {
+		var job FailedJob
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	sortFailedJobs(jobs)
+	return jobs, nil
+}
+
+func (rs *RedisFailedJobStore) Find(id string) (*FailedJob, error) {
+	ctx := context.Background()
+
+	data, err := rs.client.HGet(ctx, rs.key, id).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrFailedJobNotFound
+		}
+		return nil, err
+	}
+
+	var job FailedJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (rs *RedisFailedJobStore) Forget(id string) error {
+	ctx := context.Background()
+
+	deleted, err := rs.client.HDel(ctx, rs.key, id).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrFailedJobNotFound
+	}
+	return nil
+}
+
+func (rs *RedisFailedJobStore) Flush() error {
+	ctx := context.Background()
+	return rs.client.Del(ctx, rs.key).Err()
+}
+
+func sortFailedJobs(jobs []FailedJob) {
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].FailedAt.After(jobs[j].FailedAt)
+	})
+}
@@ -0,0 +1,275 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/test/myapp/framework/events"
+)
+
+// Job lifecycle events dispatched by workers
+const (
+	EventJobProcessing = "queue.job.processing"
+	EventJobProcessed  = "queue.job.processed"
+	EventJobRetrying   = "queue.job.retrying"
+	EventJobFailed     = "queue.job.failed"
+)
+
+// JobEvent describes a step in the life of a job on a worker
+type JobEvent struct {
+	events.BaseEvent
+	Job      Job
+	Queue    string
+	Attempts int
+	Duration time.Duration
+	Delay    time.Duration
+	Err      error
+}
+
+func newJobEvent(name string, job Job, queueName string, duration, delay time.Duration, err error) *JobEvent {
+	payload := map[string]interface{}{
+		"job_id":   job.GetID(),
+		"job":      job.GetName(),
+		"queue":    queueName,
+		"attempts": job.GetAttempts(),
+	}
+	if duration > 0 {
+		payload["duration_ms"] = duration.Milliseconds()
+	}
+	if delay > 0 {
+		payload["delay_ms"] = delay.Milliseconds()
+	}
+	if err != nil {
+		payload["exception"] = err.Error()
+	}
+
+	return &JobEvent{
+		BaseEvent: events.BaseEvent{Name: name, Payload: payload},
+		Job:       job,
+		Queue:     queueName,
+		Attempts:  job.GetAttempts(),
+		Duration:  duration,
+		Delay:     delay,
+		Err:       err,
+	}
+}
+
+// LatencyBuckets are the upper bounds, in milliseconds, of the job
+// latency histogram. Slower runs fall into a final overflow bucket.
+var LatencyBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Histogram counts observations per latency bucket
+type Histogram struct {
+	Buckets []float64 `json:"buckets_ms"`
+	Counts  []int64   `json:"counts"`
+	Count   int64     `json:"count"`
+	SumMs   float64   `json:"sum_ms"`
+}
+
+func newHistogram() Histogram {
+	return Histogram{
+		Buckets: LatencyBuckets,
+		Counts:  make([]int64, len(LatencyBuckets)+1),
+	}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	i := sort.SearchFloat64s(h.Buckets, ms)
+	h.Counts[i]++
+	h.Count++
+	h.SumMs += ms
+}
+
+// Mean returns the average latency
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return time.Duration(h.SumMs / float64(h.Count) * float64(time.Millisecond))
+}
+
+// JobMetrics holds the counters for one job name
+type JobMetrics struct {
+	Processed int64     `json:"processed"`
+	Failed    int64     `json:"failed"`
+	Retried   int64     `json:"retried"`
+	Released  int64     `json:"released"`
+	Latency   Histogram `json:"latency"`
+}
+
+// Metrics collects job counters and latencies per job name for the
+// workers of this process
+type Metrics struct {
+	jobs  map[string]*JobMetrics
+	mutex sync.Mutex
+}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{
+		jobs: make(map[string]*JobMetrics),
+	}
+}
+
+// Snapshot returns a copy of the current metrics keyed by job name
+func (m *Metrics) Snapshot() map[string]JobMetrics {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	snapshot := make(map[string]JobMetrics, len(m.jobs))
+	for name, stats := range m.jobs {
+		copied := *stats
+		copied.Latency.Counts = append([]int64(nil), stats.Latency.Counts...)
+		snapshot[name] = copied
+	}
+	return snapshot
+}
+
+// Reset clears all metrics
+func (m *Metrics) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.jobs = make(map[string]*JobMetrics)
+}
+
+func (m *Metrics) record(name string, update func(*JobMetrics)) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats, exists := m.jobs[name]
+	if !exists {
+		stats = &JobMetrics{Latency: newHistogram()}
+		m.jobs[name] = stats
+	}
+	update(stats)
+}
+
+// QueueStats counts the jobs in each state on a queue backend
+type QueueStats struct {
+	Pending  int64 `json:"pending"`
+	Delayed  int64 `json:"delayed"`
+	Reserved int64 `json:"reserved"`
+}
+
+// StatsQueue is implemented by queues that can report QueueStats
+type StatsQueue interface {
+	Stats() (QueueStats, error)
+}
+
+// QueueStatus is the state of one registered queue
+type QueueStatus struct {
+	Name string `json:"name"`
+	QueueStats
+	Failed int64 `json:"failed"`
+}
+
+// SetEventDispatcher sets the dispatcher that receives job lifecycle
+// events from workers started afterwards
+func (qm *QueueManager) SetEventDispatcher(dispatcher *events.EventDispatcher) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	qm.events = dispatcher
+}
+
+// Metrics returns the job metrics collected by this manager's workers
+func (qm *QueueManager) Metrics() *Metrics {
+	return qm.metrics
+}
+
+// Status reports the size of every registered queue, sorted by name
+func (qm *QueueManager) Status() ([]QueueStatus, error) {
+	qm.mutex.RLock()
+	names := make([]string, 0, len(qm.queues))
+	queues := make(map[string]Queue, len(qm.queues))
+	for name, queue := range qm.queues {
+		names = append(names, name)
+		queues[name] = queue
+	}
+	qm.mutex.RUnlock()
+	sort.Strings(names)
+
+	failed := make(map[string]int64)
+	failedJobs, err := qm.FailedJobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range failedJobs {
+		failed[job.Queue]++
+	}
+
+	statuses := make([]QueueStatus, 0, len(names))
+	for _, name := range names {
+		status := QueueStatus{Name: name, Failed: failed[name]}
+
+		if statsQueue, ok := queues[name].(StatsQueue); ok {
+			if status.QueueStats, err = statsQueue.Stats(); err != nil {
+				return nil, err
+			}
+		} else if status.Pending, err = queues[name].Size(); err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (rq *RedisQueue) Stats() (QueueStats, error) {
+	ctx := context.Background()
+
+	pipe := rq.client.Pipeline()
+	pending := pipe.LLen(ctx, rq.queueName)
+	delayed := pipe.ZCard(ctx, rq.delayedKey())
+	reserved := pipe.ZCard(ctx, rq.reservedKey())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return QueueStats{}, err
+	}
+
+	return QueueStats{
+		Pending:  pending.Val(),
+		Delayed:  delayed.Val(),
+		Reserved: reserved.Val(),
+	}, nil
+}
+
+func (mq *MemoryQueue) Stats() (QueueStats, error) {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	return QueueStats{
+		Pending:  int64(len(mq.jobs)),
+		Delayed:  int64(len(mq.delayed)),
+		Reserved: int64(len(mq.reserved)),
+	}, nil
+}
+
+func (pq *PriorityQueue) Stats() (QueueStats, error) {
+	var total QueueStats
+	for _, q := range pq.snapshot() {
+		statsQueue, ok := q.queue.(StatsQueue)
+		if !ok {
+			size, err := q.queue.Size()
+			if err != nil {
+				return QueueStats{}, err
+			}
+			total.Pending += size
+			continue
+		}
+
+		stats, err := statsQueue.Stats()
+		if err != nil {
+			return QueueStats{}, err
+		}
+		total.Pending += stats.Pending
+		total.Delayed += stats.Delayed
+		total.Reserved += stats.Reserved
+	}
+	return total, nil
+}
@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/test/myapp/framework/cache"
+)
+
+// JobMiddleware wraps the handling of a job, like HTTP middleware wraps a
+// request. Calling next continues the chain; returning without calling it
+// skips the job.
+type JobMiddleware func(job Job, next func() error) error
+
+// JobWithMiddleware is implemented by jobs that bring their own middleware,
+// which runs after the middleware registered on the QueueManager
+type JobWithMiddleware interface {
+	Middleware() []JobMiddleware
+}
+
+// ReleaseError asks the worker to put a job back on the queue after Delay
+// without counting the run as a failed attempt
+type ReleaseError struct {
+	Delay  time.Duration
+	Reason string
+}
+
+func (e *ReleaseError) Error() string {
+	return fmt.Sprintf("job released for %s: %s", e.Delay, e.Reason)
+}
+
+// ReleaseJob returns an error that releases the job back onto its queue
+func ReleaseJob(delay time.Duration, reason string) error {
+	return &ReleaseError{Delay: delay, Reason: reason}
+}
+
+// ErrDuplicateJob is returned by Dispatch when a unique job is already pending
+var ErrDuplicateJob = errors.New("an identical job is already queued")
+
+// Use registers middleware that wraps every job handled by workers started
+// afterwards
+func (qm *QueueManager) Use(middleware ...JobMiddleware) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	qm.middleware = append(qm.middleware, middleware...)
+}
+
+// UseDispatch registers middleware that wraps pushing a job in Dispatch
+// and Later, and pushing the jobs of batches and chains
+func (qm *QueueManager) UseDispatch(middleware ...JobMiddleware) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	qm.dispatchMiddleware = append(qm.dispatchMiddleware, middleware...)
+}
+
+// runPipeline runs the job through the middleware chain, ending with final
+func runPipeline(job Job, middleware []JobMiddleware, final func() error) error {
+	if len(middleware) == 0 {
+		return final()
+	}
+	return middleware[0](job, func() error {
+		return runPipeline(job, middleware[1:], final)
+	})
+}
+
+// WithoutOverlapping lets only one job with the same key run at a time.
+// A job that finds the key locked is released back onto the queue after
+// releaseAfter. The lock expires after expiresAfter in case a worker dies
+// while holding it.
+func WithoutOverlapping(store cache.Cache, key func(Job) string, expiresAfter, releaseAfter time.Duration) JobMiddleware {
+	return func(job Job, next func() error) error {
+		lock := store.Lock("job-overlap:"+jobKey(job, key), expiresAfter)
+
+		acquired, err := lock.Get()
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			return ReleaseJob(releaseAfter, "another "+job.GetName()+" job is running")
+		}
+		defer lock.Release()
+
+		return next()
+	}
+}
+
+// RateLimited allows at most max jobs with the same key per window. Jobs
+// over the limit are released until the next window starts.
+func RateLimited(store cache.Cache, key func(Job) string, max int64, per time.Duration) JobMiddleware {
+	return func(job Job, next func() error) error {
+		now := time.Now()
+		window := now.UnixNano() / int64(per)
+		counterKey := fmt.Sprintf("job-rate:%s:%d", jobKey(job, key), window)
+
+		// Create the counter with its expiry before incrementing it
+		if _, err := store.Add(counterKey, 0, per); err != nil {
+			return err
+		}
+		count, err := store.Increment(counterKey, 1)
+		if err != nil {
+			return err
+		}
+		if count > max {
+			retryAt := time.Unix(0, (window+1)*int64(per))
+			return ReleaseJob(retryAt.Sub(now), "rate limit reached for "+job.GetName())
+		}
+
+		return next()
+	}
+}
+
+// UniqueJob keeps an identical job from being queued while one is still
+// pending. It returns a dispatch middleware that takes the unique lock and
+// a handling middleware that frees it once the job has succeeded:
+//
+//	onDispatch, onHandle := queue.UniqueJob(store, keyFunc, time.Hour)
+//	app.Queue.UseDispatch(onDispatch)
+//	app.Queue.Use(onHandle)
+//
+// A job that keeps failing holds the lock until ttl expires.
+func UniqueJob(store cache.Cache, key func(Job) string, ttl time.Duration) (JobMiddleware, JobMiddleware) {
+	dispatch := func(job Job, next func() error) error {
+		lockKey := "job-unique:" + jobKey(job, key)
+
+		acquired, err := store.Add(lockKey, true, ttl)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			return ErrDuplicateJob
+		}
+
+		if err := next(); err != nil {
+			store.Delete(lockKey)
+			return err
+		}
+		return nil
+	}
+
+	handle := func(job Job, next func() error) error {
+		if err := next(); err != nil {
+			return err
+		}
+		return store.Delete("job-unique:" + jobKey(job, key))
+	}
+
+	return dispatch, handle
+}
+
+// jobKey namespaces a middleware key by job name
+func jobKey(job Job, key func(Job) string) string {
+	if key == nil {
+		return job.GetName()
+	}
+	return job.GetName() + ":" + key(job)
+}
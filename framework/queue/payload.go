@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PayloadVersion is the envelope version written by the queue backends.
+//
+// Version 1 envelopes carry only id, name, payload and attempts. Version 2
+// adds the JSON form of the whole job struct in "data", so typed jobs get
+// their fields back when they are popped.
+const PayloadVersion = 2
+
+// envelope is the serialized form of a job on a queue backend
+type envelope struct {
+	Version    int                    `json:"version,omitempty"`
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Payload    map[string]interface{} `json:"payload"`
+	Attempts   int                    `json:"attempts"`
+	JobVersion int                    `json:"job_version,omitempty"`
+	Data       json.RawMessage        `json:"data,omitempty"`
+	Chain      []json.RawMessage      `json:"chain,omitempty"`
+	Batch      string                 `json:"batch,omitempty"`
+}
+
+// VersionedJob is implemented by typed jobs whose struct layout changes
+// between deploys. UpgradePayload receives data written by an older
+// JobVersion and returns it in the current layout.
+type VersionedJob interface {
+	JobVersion() int
+	UpgradePayload(from int, data []byte) ([]byte, error)
+}
+
+// RegisterTypedJob registers a job type that is serialized as a whole on
+// Push and unmarshalled back into a fresh *T before Handle runs:
+//
+//	queue.RegisterTypedJob[jobs.SendEmailJob](app.Queue, "send_email")
+func RegisterTypedJob[T any, PT interface {
+	*T
+	Job
+}](qm *QueueManager, name string) {
+	qm.RegisterJob(name, func() Job {
+		return PT(new(T))
+	})
+}
+
+// encodeJob serializes a job into the current envelope format
+func encodeJob(job Job) ([]byte, error) {
+	env := envelope{
+		Version:  PayloadVersion,
+		ID:       job.GetID(),
+		Name:     job.GetName(),
+		Payload:  job.GetPayload(),
+		Attempts: job.GetAttempts(),
+	}
+
+	if bj, ok := job.(*BaseJob); ok {
+		// A popped job being released keeps the data it was pushed with
+		env.Data = bj.data
+		env.JobVersion = bj.dataVersion
+		env.Chain = bj.chain
+		env.Batch = bj.batchID
+	} else {
+		data, err := json.Marshal(job)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize job %s: %w", job.GetName(), err)
+		}
+		env.Data = data
+		if versioned, ok := job.(VersionedJob); ok {
+			env.JobVersion = versioned.JobVersion()
+		}
+	}
+
+	return json.Marshal(env)
+}
+
+// decodeJob deserializes an envelope of any supported version
+func decodeJob(raw []byte) (*BaseJob, error) {
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, err
+	}
+
+	if env.Version > PayloadVersion {
+		return nil, fmt.Errorf("unsupported job payload version %d", env.Version)
+	}
+
+	return &BaseJob{
+		ID:          env.ID,
+		Name:        env.Name,
+		Payload:     env.Payload,
+		Attempts:    env.Attempts,
+		data:        env.Data,
+		dataVersion: env.JobVersion,
+		chain:       env.Chain,
+		batchID:     env.Batch,
+	}, nil
+}
+
+// hydrateJob fills a registered job instance from a popped job
+func hydrateJob(instance Job, job Job) error {
+	// Version 1 envelopes have no data and are hydrated through SetPayload only
+	data, version := jobData(job)
+
+	if len(data) > 0 {
+		if versioned, ok := instance.(VersionedJob); ok && version < versioned.JobVersion() {
+			upgraded, err := versioned.UpgradePayload(version, data)
+			if err != nil {
+				return fmt.Errorf("failed to upgrade job %s from version %d: %w", job.GetName(), version, err)
+			}
+			data = upgraded
+		}
+
+		if err := json.Unmarshal(data, instance); err != nil {
+			return fmt.Errorf("failed to hydrate job %s: %w", job.GetName(), err)
+		}
+	}
+
+	instance.SetID(job.GetID())
+	instance.SetPayload(job.GetPayload())
+	instance.SetAttempts(job.GetAttempts())
+	return nil
+}
+
+func jobData(job Job) (json.RawMessage, int) {
+	if bj, ok := job.(*BaseJob); ok {
+		return bj.data, bj.dataVersion
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, 0
+	}
+	version := 0
+	if versioned, ok := job.(VersionedJob); ok {
+		version = versioned.JobVersion()
+	}
+	return data, version
+}
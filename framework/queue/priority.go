@@ -0,0 +1,297 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PriorityQueue consumes from several queues at once. Without weights the
+// queues are polled in strict priority order, so a job on a later queue only
+// runs when every earlier queue is empty. With weights each Pop polls the
+// queues in a random order biased by weight, so busy high-priority queues
+// cannot starve the others completely.
+//
+// Ack and Release are routed back to the queue a job was popped from.
+type PriorityQueue struct {
+	queues   []namedQueue
+	weighted bool
+	origins  map[string]namedQueue
+	mutex    sync.Mutex
+}
+
+// nonBlockingPopper is implemented by queues whose PopCtx waits for a job
+// while they are empty
+type nonBlockingPopper interface {
+	popNow(ctx context.Context) (Job, error)
+}
+
+type namedQueue struct {
+	name   string
+	queue  Queue
+	weight int
+}
+
+// NewPriorityQueue creates an empty priority queue
+func NewPriorityQueue() *PriorityQueue {
+	return &PriorityQueue{
+		origins: make(map[string]namedQueue),
+	}
+}
+
+// Add appends a queue with the given weight. Queues added earlier have
+// higher priority; a weight above zero switches to weighted polling.
+func (pq *PriorityQueue) Add(name string, queue Queue, weight int) *PriorityQueue {
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+
+	if weight > 0 {
+		pq.weighted = true
+	}
+	pq.queues = append(pq.queues, namedQueue{name: name, queue: queue, weight: weight})
+	return pq
+}
+
+// Names returns the queue names in priority order
+func (pq *PriorityQueue) Names() []string {
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+
+	names := make([]string, len(pq.queues))
+	for i, q := range pq.queues {
+		names[i] = q.name
+	}
+	return names
+}
+
+// Origin returns the name of the queue a reserved job was popped from
+func (pq *PriorityQueue) Origin(job Job) (string, bool) {
+	origin, exists := pq.origin(job)
+	return origin.name, exists
+}
+
+func (pq *PriorityQueue) origin(job Job) (namedQueue, bool) {
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+
+	origin, exists := pq.origins[job.GetID()]
+	return origin, exists
+}
+
+// Push adds a job to the highest-priority queue
+func (pq *PriorityQueue) Push(job Job, delay ...time.Duration) error {
+	return pq.PushCtx(context.Background(), job, delay...)
+}
+
+func (pq *PriorityQueue) PushCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	pq.mutex.Lock()
+	if len(pq.queues) == 0 {
+		pq.mutex.Unlock()
+		return fmt.Errorf("priority queue has no queues")
+	}
+	first := pq.queues[0]
+	pq.mutex.Unlock()
+
+	return first.queue.PushCtx(ctx, job, delay...)
+}
+
+func (pq *PriorityQueue) Pop() (Job, error) {
+	return pq.PopCtx(context.Background())
+}
+
+// PopCtx polls the queues in order. Queues that wait for a job while empty
+// are polled without waiting, so one empty queue cannot hold up the others.
+func (pq *PriorityQueue) PopCtx(ctx context.Context) (Job, error) {
+	for _, q := range pq.pollOrder() {
+		pop := q.queue.PopCtx
+		if nb, ok := q.queue.(nonBlockingPopper); ok {
+			pop = nb.popNow
+		}
+
+		job, err := pop(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("queue %s: %w", q.name, err)
+		}
+		if job == nil {
+			continue
+		}
+
+		pq.mutex.Lock()
+		pq.origins[job.GetID()] = q
+		pq.mutex.Unlock()
+		return job, nil
+	}
+	return nil, nil
+}
+
+func (pq *PriorityQueue) Ack(job Job) error {
+	return pq.AckCtx(context.Background(), job)
+}
+
+func (pq *PriorityQueue) AckCtx(ctx context.Context, job Job) error {
+	origin, err := pq.takeOrigin(job)
+	if err != nil {
+		return err
+	}
+	return origin.queue.AckCtx(ctx, job)
+}
+
+func (pq *PriorityQueue) Release(job Job, delay ...time.Duration) error {
+	return pq.ReleaseCtx(context.Background(), job, delay...)
+}
+
+func (pq *PriorityQueue) ReleaseCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	origin, err := pq.takeOrigin(job)
+	if err != nil {
+		return err
+	}
+	return origin.queue.ReleaseCtx(ctx, job, delay...)
+}
+
+// VisibilityTimeout returns the shortest visibility timeout of the queues
+// whose reservations can be extended, or zero if there are none
+func (pq *PriorityQueue) VisibilityTimeout() time.Duration {
+	var shortest time.Duration
+	for _, q := range pq.snapshot() {
+		if extender, ok := q.queue.(Extender); ok {
+			if timeout := extender.VisibilityTimeout(); shortest == 0 || timeout < shortest {
+				shortest = timeout
+			}
+		}
+	}
+	return shortest
+}
+
+// ExtendCtx extends the reservation on the queue the job was popped from
+func (pq *PriorityQueue) ExtendCtx(ctx context.Context, job Job) error {
+	origin, exists := pq.origin(job)
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrNotReserved, job.GetID())
+	}
+	if extender, ok := origin.queue.(Extender); ok {
+		return extender.ExtendCtx(ctx, job)
+	}
+	return nil
+}
+
+func (pq *PriorityQueue) Size() (int64, error) {
+	return pq.SizeCtx(context.Background())
+}
+
+func (pq *PriorityQueue) SizeCtx(ctx context.Context) (int64, error) {
+	var total int64
+	for _, q := range pq.snapshot() {
+		size, err := q.queue.SizeCtx(ctx)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+func (pq *PriorityQueue) Clear() error {
+	return pq.ClearCtx(context.Background())
+}
+
+func (pq *PriorityQueue) ClearCtx(ctx context.Context) error {
+	for _, q := range pq.snapshot() {
+		if err := q.queue.ClearCtx(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pq *PriorityQueue) takeOrigin(job Job) (namedQueue, error) {
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+
+	origin, exists := pq.origins[job.GetID()]
+	if !exists {
+		return namedQueue{}, fmt.Errorf("job %s is not reserved", job.GetID())
+	}
+	delete(pq.origins, job.GetID())
+	return origin, nil
+}
+
+func (pq *PriorityQueue) snapshot() []namedQueue {
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+	return append([]namedQueue(nil), pq.queues...)
+}
+
+// pollOrder returns the queues in the order the next Pop should try them
+func (pq *PriorityQueue) pollOrder() []namedQueue {
+	pq.mutex.Lock()
+	queues := append([]namedQueue(nil), pq.queues...)
+	weighted := pq.weighted
+	pq.mutex.Unlock()
+
+	if !weighted {
+		return queues
+	}
+
+	// Weighted shuffle: repeatedly draw a queue with probability
+	// proportional to its weight
+	order := make([]namedQueue, 0, len(queues))
+	for len(queues) > 0 {
+		total := 0
+		for _, q := range queues {
+			total += weightOf(q)
+		}
+
+		pick := rand.Intn(total)
+		for i, q := range queues {
+			pick -= weightOf(q)
+			if pick < 0 {
+				order = append(order, q)
+				queues = append(queues[:i], queues[i+1:]...)
+				break
+			}
+		}
+	}
+	return order
+}
+
+func weightOf(q namedQueue) int {
+	if q.weight < 1 {
+		return 1
+	}
+	return q.weight
+}
+
+// parseQueueSpec splits a worker spec such as "high,default,low" or
+// "high:5,default:3,low:1" into queue names and weights
+func parseQueueSpec(spec string) ([]string, []int, error) {
+	var names []string
+	var weights []int
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, weight := part, 0
+		if i := strings.LastIndex(part, ":"); i >= 0 {
+			w, err := strconv.Atoi(part[i+1:])
+			if err != nil || w < 1 {
+				return nil, nil, fmt.Errorf("invalid weight in queue spec %q", part)
+			}
+			name, weight = part[:i], w
+		}
+
+		names = append(names, name)
+		weights = append(weights, weight)
+	}
+
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("empty queue spec")
+	}
+	return names, weights, nil
+}
@@ -1,14 +1,20 @@
 package queue
 
 import (
+	"container/heap"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/test/myapp/framework/database"
+	"github.com/test/myapp/framework/events"
 )
 
 // Job represents a job to be processed
@@ -17,12 +23,28 @@ type Job interface {
 	GetName() string
 	GetPayload() map[string]interface{}
 	SetPayload(map[string]interface{})
+	GetAttempts() int
+	SetAttempts(int)
+	GetID() string
+	SetID(string)
 }
 
 // BaseJob provides basic job functionality
 type BaseJob struct {
-	Name    string                 `json:"name"`
-	Payload map[string]interface{} `json:"payload"`
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name"`
+	Payload  map[string]interface{} `json:"payload"`
+	Attempts int                    `json:"attempts"`
+
+	// data is the serialized job struct carried by a popped job
+	data        json.RawMessage
+	dataVersion int
+	// chain holds the jobs to queue after this one succeeds
+	chain   []json.RawMessage
+	batchID string
+	// reservation identifies the pop that reserved the job, for queues
+	// that tell reservations of the same job apart
+	reservation string
 }
 
 func (bj *BaseJob) Handle() error {
@@ -42,12 +64,54 @@ func (bj *BaseJob) SetPayload(payload map[string]interface{}) {
 	bj.Payload = payload
 }
 
-// Queue interface defines queue operations
+func (bj *BaseJob) GetAttempts() int {
+	return bj.Attempts
+}
+
+func (bj *BaseJob) SetAttempts(attempts int) {
+	bj.Attempts = attempts
+}
+
+func (bj *BaseJob) GetID() string {
+	return bj.ID
+}
+
+func (bj *BaseJob) SetID(id string) {
+	bj.ID = id
+}
+
+// Queue interface defines queue operations.
+// Pop reserves a job; it must then be acknowledged with Ack once handled,
+// or handed back with Release. Reservations that are neither acknowledged
+// nor released in time are returned to the queue.
+// The Ctx variants stop when the context is cancelled; the plain methods
+// use a background context.
 type Queue interface {
 	Push(job Job, delay ...time.Duration) error
 	Pop() (Job, error)
+	Ack(job Job) error
+	Release(job Job, delay ...time.Duration) error
 	Size() (int64, error)
 	Clear() error
+	
+	PushCtx(ctx context.Context, job Job, delay ...time.Duration) error
+	PopCtx(ctx context.Context) (Job, error)
+	AckCtx(ctx context.Context, job Job) error
+	ReleaseCtx(ctx context.Context, job Job, delay ...time.Duration) error
+	SizeCtx(ctx context.Context) (int64, error)
+	ClearCtx(ctx context.Context) error
+}
+
+// DefaultOperationTimeout bounds each Redis call made by a queue when the
+// caller's context has no earlier deadline
+const DefaultOperationTimeout = 5 * time.Second
+
+// withTimeout applies an operation timeout to ctx; zero disables it
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
 // QueueManager manages job queues
@@ -55,8 +119,17 @@ type QueueManager struct {
 	queues   map[string]Queue
 	workers  map[string]*Worker
 	handlers map[string]func() Job
+	failed   FailedJobStore
+	retry    RetryPolicy
 	default_ string
 	mutex    sync.RWMutex
+
+	middleware         []JobMiddleware
+	dispatchMiddleware []JobMiddleware
+	batches            BatchRepository
+	batchCallbacks     map[string]*batchCallbacks
+	events             *events.EventDispatcher
+	metrics            *Metrics
 }
 
 // NewQueueManager creates a new queue manager
@@ -65,6 +138,12 @@ func NewQueueManager() *QueueManager {
 		queues:   make(map[string]Queue),
 		workers:  make(map[string]*Worker),
 		handlers: make(map[string]func() Job),
+		failed:   NewMemoryFailedJobStore(),
+		retry:    DefaultRetryPolicy(),
+		batches:  NewMemoryBatchRepository(),
+		metrics:  NewMetrics(),
+
+		batchCallbacks: make(map[string]*batchCallbacks),
 	}
 }
 
@@ -79,6 +158,14 @@ func (qm *QueueManager) AddQueue(name string, queue Queue) {
 	}
 }
 
+// SetDefault sets the queue used when no queue name is given
+func (qm *QueueManager) SetDefault(name string) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	
+	qm.default_ = name
+}
+
 // Queue returns a queue by name
 func (qm *QueueManager) Queue(name ...string) Queue {
 	qm.mutex.RLock()
@@ -100,11 +187,63 @@ func (qm *QueueManager) RegisterJob(name string, handler func() Job) {
 
 // Dispatch dispatches a job to queue
 func (qm *QueueManager) Dispatch(job Job, queueName ...string) error {
+	return qm.DispatchCtx(context.Background(), job, queueName...)
+}
+
+// DispatchCtx dispatches a job, giving up when ctx is cancelled
+func (qm *QueueManager) DispatchCtx(ctx context.Context, job Job, queueName ...string) error {
+	queue := qm.Queue(queueName...)
+	return qm.push(ctx, queue, job)
+}
+
+// DispatchAfterCommit dispatches a job once the database transaction ctx
+// carries has committed, so workers never see rows that were rolled back.
+// Without a transaction the job is dispatched right away. Errors from a
+// deferred dispatch are logged.
+func (qm *QueueManager) DispatchAfterCommit(ctx context.Context, job Job, queueName ...string) error {
+	if !database.InTransaction(ctx) {
+		return qm.DispatchCtx(ctx, job, queueName...)
+	}
+	
+	database.AfterCommit(ctx, func() {
+		if err := qm.DispatchCtx(context.WithoutCancel(ctx), job, queueName...); err != nil {
+			log.Printf("Failed to dispatch job %s after commit: %v", job.GetName(), err)
+		}
+	})
+	return nil
+}
+
+// Later dispatches a job that becomes available at the given time
+func (qm *QueueManager) Later(at time.Time, job Job, queueName ...string) error {
+	return qm.LaterCtx(context.Background(), at, job, queueName...)
+}
+
+// LaterCtx dispatches a delayed job, giving up when ctx is cancelled
+func (qm *QueueManager) LaterCtx(ctx context.Context, at time.Time, job Job, queueName ...string) error {
 	queue := qm.Queue(queueName...)
-	return queue.Push(job)
+	return qm.push(ctx, queue, job, time.Until(at))
+}
+
+// push pushes a job through the dispatch middleware
+func (qm *QueueManager) push(ctx context.Context, queue Queue, job Job, delay ...time.Duration) error {
+	return qm.pushAs(ctx, queue, job, job, delay...)
 }
 
-// StartWorker starts a worker for a queue
+// pushAs runs the dispatch middleware on job and pushes queued, the form of
+// job that carries its batch or chain
+func (qm *QueueManager) pushAs(ctx context.Context, queue Queue, job, queued Job, delay ...time.Duration) error {
+	qm.mutex.RLock()
+	middleware := qm.dispatchMiddleware
+	qm.mutex.RUnlock()
+	
+	return runPipeline(job, middleware, func() error {
+		return queue.PushCtx(ctx, queued, delay...)
+	})
+}
+
+// StartWorker starts a worker for a queue. The name may list several
+// queues for one worker to consume, in strict priority order
+// ("high,default,low") or weighted ("high:5,default:3,low:1").
 func (qm *QueueManager) StartWorker(queueName string, concurrency int) {
 	qm.mutex.Lock()
 	defer qm.mutex.Unlock()
@@ -113,13 +252,54 @@ func (qm *QueueManager) StartWorker(queueName string, concurrency int) {
 		return // Worker already running
 	}
 	
-	worker := NewWorker(qm.queues[queueName], qm.handlers, concurrency)
+	queue, err := qm.workerQueue(queueName)
+	if err != nil {
+		log.Printf("❌ Cannot start queue worker for '%s': %v", queueName, err)
+		return
+	}
+	
+	worker := NewWorker(queue, qm.handlers, concurrency)
+	worker.name = queueName
+	worker.failed = qm.failed
+	worker.retry = qm.retry
+	worker.middleware = qm.middleware
+	worker.manager = qm
+	worker.events = qm.events
+	worker.metrics = qm.metrics
 	qm.workers[queueName] = worker
 	go worker.Start()
 	
 	log.Printf("🚀 Started queue worker for '%s' with %d workers", queueName, concurrency)
 }
 
+// workerQueue resolves a worker spec to the queue it consumes. A spec
+// listing several queues, such as "high,default,low" for strict priority
+// or "high:5,default:3,low:1" for weighted polling, becomes a PriorityQueue.
+func (qm *QueueManager) workerQueue(spec string) (Queue, error) {
+	if !strings.ContainsAny(spec, ",:") {
+		queue, exists := qm.queues[spec]
+		if !exists {
+			return nil, fmt.Errorf("queue %s not found", spec)
+		}
+		return queue, nil
+	}
+	
+	names, weights, err := parseQueueSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	
+	pq := NewPriorityQueue()
+	for i, name := range names {
+		queue, exists := qm.queues[name]
+		if !exists {
+			return nil, fmt.Errorf("queue %s not found", name)
+		}
+		pq.Add(name, queue, weights[i])
+	}
+	return pq, nil
+}
+
 // StopWorker stops a worker
 func (qm *QueueManager) StopWorker(queueName string) {
 	qm.mutex.Lock()
@@ -132,52 +312,276 @@ func (qm *QueueManager) StopWorker(queueName string) {
 	}
 }
 
-// RedisQueue implements Redis-based queue
+// Shutdown stops all workers, letting in-flight jobs finish until the
+// context is done. Jobs still running at the deadline are released back
+// to their queue.
+func (qm *QueueManager) Shutdown(ctx context.Context) error {
+	qm.mutex.Lock()
+	workers := qm.workers
+	qm.workers = make(map[string]*Worker)
+	qm.mutex.Unlock()
+	
+	var wg sync.WaitGroup
+	errs := make(chan error, len(workers))
+	for name, worker := range workers {
+		wg.Add(1)
+		go func(name string, worker *Worker) {
+			defer wg.Done()
+			if err := worker.StopContext(ctx); err != nil {
+				errs <- fmt.Errorf("queue worker '%s': %w", name, err)
+				return
+			}
+			log.Printf("🛑 Stopped queue worker for '%s'", name)
+		}(name, worker)
+	}
+	wg.Wait()
+	close(errs)
+	
+	var result []error
+	for err := range errs {
+		result = append(result, err)
+	}
+	return errors.Join(result...)
+}
+
+// DefaultVisibilityTimeout is how long a popped job stays reserved before
+// it is handed to another worker
+const DefaultVisibilityTimeout = 60 * time.Second
+
+// DefaultBlockTimeout is how long a Redis Pop waits for a job to be pushed
+// while the queue is empty
+const DefaultBlockTimeout = time.Second
+
+// ErrNotReserved is returned when extending a job that is no longer
+// reserved, because it was acknowledged, released or reaped
+var ErrNotReserved = fmt.Errorf("job is not reserved")
+
+// Extender is implemented by queues whose reservations can be extended.
+// While a job runs, its worker extends the reservation every third of the
+// visibility timeout, so a long job is not handed to another worker.
+type Extender interface {
+	VisibilityTimeout() time.Duration
+	ExtendCtx(ctx context.Context, job Job) error
+}
+
+// RedisQueue implements Redis-based queue.
+//
+// Reservations live in Redis, not in the memory of the worker holding them:
+// the :reserved sorted set scores job IDs by their deadline and the
+// :reservations hash holds their payloads, so any process can acknowledge,
+// release or reap a job. Every push adds an entry to the :notify list, which
+// Pop blocks on while the queue is empty.
 type RedisQueue struct {
-	client    *redis.Client
-	queueName string
+	client            *redis.Client
+	queueName         string
+	visibilityTimeout time.Duration
+	blockTimeout      time.Duration
+	timeout           time.Duration
 }
 
 // NewRedisQueue creates a new Redis queue
 func NewRedisQueue(client *redis.Client, queueName string) *RedisQueue {
 	return &RedisQueue{
-		client:    client,
-		queueName: queueName,
+		client:            client,
+		queueName:         queueName,
+		visibilityTimeout: DefaultVisibilityTimeout,
+		blockTimeout:      DefaultBlockTimeout,
+		timeout:           DefaultOperationTimeout,
 	}
 }
 
+// SetVisibilityTimeout sets how long a popped job stays reserved
+func (rq *RedisQueue) SetVisibilityTimeout(timeout time.Duration) {
+	rq.visibilityTimeout = timeout
+}
+
+// VisibilityTimeout returns how long a popped job stays reserved
+func (rq *RedisQueue) VisibilityTimeout() time.Duration {
+	return rq.visibilityTimeout
+}
+
+// SetBlockTimeout sets how long Pop waits for a job while the queue is
+// empty. Redis counts it in whole seconds; zero makes Pop return at once.
+func (rq *RedisQueue) SetBlockTimeout(timeout time.Duration) {
+	rq.blockTimeout = timeout
+}
+
+// SetOperationTimeout bounds each operation when the caller's context has
+// no earlier deadline. Zero disables the timeout.
+func (rq *RedisQueue) SetOperationTimeout(timeout time.Duration) {
+	rq.timeout = timeout
+}
+
+// pushScript queues a job and notifies a blocked Pop
+var pushScript = redis.NewScript(`
+redis.call('LPUSH', KEYS[1], ARGV[1])
+redis.call('RPUSH', KEYS[2], 1)
+return 1
+`)
+
+// popScript reserves the next job in one step, so a job is never held only
+// in the memory of a worker that may crash
+var popScript = redis.NewScript(`
+local job = redis.call('RPOP', KEYS[1])
+if not job then
+	return false
+end
+local id = job
+local ok, decoded = pcall(cjson.decode, job)
+if ok and type(decoded) == 'table' and type(decoded['id']) == 'string' then
+	id = decoded['id']
+end
+redis.call('ZADD', KEYS[2], ARGV[1], id)
+redis.call('HSET', KEYS[3], id, job)
+redis.call('LPOP', KEYS[4])
+return job
+`)
+
+// ackScript removes a reservation
+var ackScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1
+`)
+
+// releaseScript removes a reservation and queues the job's new payload. A
+// job whose reservation is gone was already put back by the reaper, so it
+// is not queued twice.
+var releaseScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[3], ARGV[1])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('ZADD', KEYS[4], ARGV[3], ARGV[2])
+else
+	redis.call('LPUSH', KEYS[1], ARGV[2])
+	redis.call('RPUSH', KEYS[5], 1)
+end
+return 1
+`)
+
+// extendScript moves the deadline of a reservation that still exists
+var extendScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// reapScript puts jobs whose reservation expired back at the head of the
+// queue. Reservations written by older releases hold the payload itself.
+var reapScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, id in ipairs(ids) do
+	local job = redis.call('HGET', KEYS[3], id)
+	if not job and string.sub(id, 1, 1) == '{' then
+		job = id
+	end
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('HDEL', KEYS[3], id)
+	if job then
+		redis.call('RPUSH', KEYS[1], job)
+		redis.call('RPUSH', KEYS[4], 1)
+	end
+end
+return #ids
+`)
+
+// promoteScript moves due delayed jobs onto the queue atomically, so two
+// workers can never both promote the same job
+var promoteScript = redis.NewScript(`
+local jobs = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, job in ipairs(jobs) do
+	redis.call('ZREM', KEYS[2], job)
+	redis.call('LPUSH', KEYS[1], job)
+	redis.call('RPUSH', KEYS[3], 1)
+end
+return #jobs
+`)
+
+func (rq *RedisQueue) reservedKey() string {
+	return rq.queueName + ":reserved"
+}
+
+func (rq *RedisQueue) reservationsKey() string {
+	return rq.queueName + ":reservations"
+}
+
+func (rq *RedisQueue) delayedKey() string {
+	return rq.queueName + ":delayed"
+}
+
+func (rq *RedisQueue) notifyKey() string {
+	return rq.queueName + ":notify"
+}
+
 func (rq *RedisQueue) Push(job Job, delay ...time.Duration) error {
-	ctx := context.Background()
-	
-	jobData := map[string]interface{}{
-		"name":    job.GetName(),
-		"payload": job.GetPayload(),
-	}
+	return rq.PushCtx(context.Background(), job, delay...)
+}
+
+func (rq *RedisQueue) PushCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	ctx, cancel := withTimeout(ctx, rq.timeout)
+	defer cancel()
 	
-	data, err := json.Marshal(jobData)
+	job.SetID(uuid.NewString())
+	data, err := encodeJob(job)
 	if err != nil {
 		return err
 	}
 	
 	if len(delay) > 0 && delay[0] > 0 {
-		// Delayed job
-		score := float64(time.Now().Add(delay[0]).Unix())
-		return rq.client.ZAdd(ctx, rq.queueName+":delayed", redis.Z{
+		// Delayed job, scored in milliseconds
+		score := float64(time.Now().Add(delay[0]).UnixMilli())
+		return rq.client.ZAdd(ctx, rq.delayedKey(), redis.Z{
 			Score:  score,
 			Member: data,
 		}).Err()
 	}
 	
-	return rq.client.LPush(ctx, rq.queueName, data).Err()
+	return pushScript.Run(ctx, rq.client, []string{rq.queueName, rq.notifyKey()}, data).Err()
 }
 
 func (rq *RedisQueue) Pop() (Job, error) {
-	ctx := context.Background()
+	return rq.PopCtx(context.Background())
+}
+
+// PopCtx reserves the next job, waiting up to the block timeout for one to
+// be pushed while the queue is empty
+func (rq *RedisQueue) PopCtx(ctx context.Context) (Job, error) {
+	job, err := rq.popNow(ctx)
+	if job != nil || err != nil || !rq.blocking() {
+		return job, err
+	}
+	
+	if err := rq.waitForPush(ctx); err != nil {
+		return nil, err
+	}
+	return rq.popNow(ctx)
+}
+
+// blocking reports whether PopCtx waits for a job while the queue is empty
+func (rq *RedisQueue) blocking() bool {
+	return rq.blockTimeout > 0
+}
+
+// popNow reserves the next job without waiting for one to be pushed
+func (rq *RedisQueue) popNow(ctx context.Context) (Job, error) {
+	ctx, cancel := withTimeout(ctx, rq.timeout)
+	defer cancel()
 	
-	// First check for delayed jobs that are ready
-	rq.processDelayedJobs()
+	// Return expired reservations and ready delayed jobs first
+	if _, err := rq.reapExpired(ctx); err != nil {
+		return nil, err
+	}
+	if err := rq.processDelayedJobs(ctx); err != nil {
+		return nil, err
+	}
 	
-	result, err := rq.client.BRPop(ctx, 1*time.Second, rq.queueName).Result()
+	deadline := time.Now().Add(rq.visibilityTimeout).UnixMilli()
+	keys := []string{rq.queueName, rq.reservedKey(), rq.reservationsKey(), rq.notifyKey()}
+	result, err := popScript.Run(ctx, rq.client, keys, deadline).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil // No job available
@@ -185,57 +589,163 @@ func (rq *RedisQueue) Pop() (Job, error) {
 		return nil, err
 	}
 	
-	var jobData map[string]interface{}
-	if err := json.Unmarshal([]byte(result[1]), &jobData); err != nil {
-		return nil, err
+	raw, ok := result.(string)
+	if !ok {
+		return nil, nil
 	}
 	
-	job := &BaseJob{
-		Name:    jobData["name"].(string),
-		Payload: jobData["payload"].(map[string]interface{}),
+	job, err := decodeJob([]byte(raw))
+	if err != nil {
+		return nil, err
 	}
-	
 	return job, nil
 }
 
-func (rq *RedisQueue) Size() (int64, error) {
-	ctx := context.Background()
-	return rq.client.LLen(ctx, rq.queueName).Result()
+// waitForPush blocks until a job is pushed or the block timeout passes
+func (rq *RedisQueue) waitForPush(ctx context.Context) error {
+	timeout := rq.timeout
+	if timeout > 0 {
+		timeout += rq.blockTimeout
+	}
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	
+	err := rq.client.BLPop(ctx, rq.blockTimeout, rq.notifyKey()).Err()
+	if err == redis.Nil {
+		return nil
+	}
+	return err
 }
 
-func (rq *RedisQueue) Clear() error {
-	ctx := context.Background()
-	return rq.client.Del(ctx, rq.queueName).Err()
+// Ack removes a processed job from the reserved set
+func (rq *RedisQueue) Ack(job Job) error {
+	return rq.AckCtx(context.Background(), job)
 }
 
-func (rq *RedisQueue) processDelayedJobs() {
-	ctx := context.Background()
-	now := float64(time.Now().Unix())
+func (rq *RedisQueue) AckCtx(ctx context.Context, job Job) error {
+	ctx, cancel := withTimeout(ctx, rq.timeout)
+	defer cancel()
 	
-	// Get ready delayed jobs
-	jobs, err := rq.client.ZRangeByScore(ctx, rq.queueName+":delayed", &redis.ZRangeBy{
-		Min: "0",
-		Max: fmt.Sprintf("%f", now),
-	}).Result()
+	keys := []string{rq.reservedKey(), rq.reservationsKey()}
+	return ackScript.Run(ctx, rq.client, keys, job.GetID()).Err()
+}
+
+// Release returns a reserved job to the queue, optionally after a delay
+func (rq *RedisQueue) Release(job Job, delay ...time.Duration) error {
+	return rq.ReleaseCtx(context.Background(), job, delay...)
+}
+
+func (rq *RedisQueue) ReleaseCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	ctx, cancel := withTimeout(ctx, rq.timeout)
+	defer cancel()
 	
-	if err != nil || len(jobs) == 0 {
-		return
+	data, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	
+	var score int64
+	if len(delay) > 0 && delay[0] > 0 {
+		score = time.Now().Add(delay[0]).UnixMilli()
 	}
 	
-	// Move ready jobs to main queue
-	for _, job := range jobs {
-		rq.client.LPush(ctx, rq.queueName, job)
-		rq.client.ZRem(ctx, rq.queueName+":delayed", job)
+	keys := []string{rq.queueName, rq.reservedKey(), rq.reservationsKey(), rq.delayedKey(), rq.notifyKey()}
+	return releaseScript.Run(ctx, rq.client, keys, job.GetID(), data, score).Err()
+}
+
+// Extend pushes the deadline of a job's reservation a visibility timeout
+// into the future
+func (rq *RedisQueue) Extend(job Job) error {
+	return rq.ExtendCtx(context.Background(), job)
+}
+
+func (rq *RedisQueue) ExtendCtx(ctx context.Context, job Job) error {
+	ctx, cancel := withTimeout(ctx, rq.timeout)
+	defer cancel()
+	
+	deadline := time.Now().Add(rq.visibilityTimeout).UnixMilli()
+	extended, err := extendScript.Run(ctx, rq.client, []string{rq.reservedKey()}, job.GetID(), deadline).Int()
+	if err != nil {
+		return err
+	}
+	if extended == 0 {
+		return fmt.Errorf("%w: %s", ErrNotReserved, job.GetID())
 	}
+	return nil
+}
+
+// ReapExpired re-queues jobs whose visibility timeout has passed, which
+// happens when the worker holding them died before acknowledging
+func (rq *RedisQueue) ReapExpired() (int64, error) {
+	ctx, cancel := withTimeout(context.Background(), rq.timeout)
+	defer cancel()
+	return rq.reapExpired(ctx)
+}
+
+func (rq *RedisQueue) reapExpired(ctx context.Context) (int64, error) {
+	now := time.Now().UnixMilli()
+	
+	keys := []string{rq.queueName, rq.reservedKey(), rq.reservationsKey(), rq.notifyKey()}
+	return reapScript.Run(ctx, rq.client, keys, now).Int64()
+}
+
+func (rq *RedisQueue) Size() (int64, error) {
+	return rq.SizeCtx(context.Background())
+}
+
+func (rq *RedisQueue) SizeCtx(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx, rq.timeout)
+	defer cancel()
+	return rq.client.LLen(ctx, rq.queueName).Result()
+}
+
+func (rq *RedisQueue) Clear() error {
+	return rq.ClearCtx(context.Background())
+}
+
+func (rq *RedisQueue) ClearCtx(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, rq.timeout)
+	defer cancel()
+	return rq.client.Del(ctx, rq.queueName, rq.delayedKey(), rq.reservedKey(), rq.reservationsKey(), rq.notifyKey()).Err()
+}
+
+// processDelayedJobs moves due delayed jobs onto the queue. Scores written
+// by older releases are in seconds and therefore always count as due.
+func (rq *RedisQueue) processDelayedJobs(ctx context.Context) error {
+	now := time.Now().UnixMilli()
+	
+	return promoteScript.Run(ctx, rq.client, []string{rq.queueName, rq.delayedKey(), rq.notifyKey()}, now).Err()
 }
 
 // Worker processes jobs from queue
 type Worker struct {
+	name        string
+	manager     *QueueManager
 	queue       Queue
 	handlers    map[string]func() Job
+	failed      FailedJobStore
+	retry       RetryPolicy
+	middleware  []JobMiddleware
+	events      *events.EventDispatcher
+	metrics     *Metrics
 	concurrency int
 	quit        chan bool
+	stopOnce    sync.Once
+	done        chan struct{}
 	wg          sync.WaitGroup
+	inflight    map[string]*inflightJob
+	mutex       sync.Mutex
+}
+
+// inflightJob is a job a worker is running. Its goroutine acknowledges or
+// releases it, unless StopContext gave up waiting and released it first.
+type inflightJob struct {
+	// popped is a copy of the job as it was popped, released by StopContext
+	// while the running goroutine may still change the job itself
+	popped    Job
+	settled   bool
+	abandoned bool
+	mutex     sync.Mutex
 }
 
 // NewWorker creates a new worker
@@ -243,27 +753,83 @@ func NewWorker(queue Queue, handlers map[string]func() Job, concurrency int) *Wo
 	return &Worker{
 		queue:       queue,
 		handlers:    handlers,
+		retry:       DefaultRetryPolicy(),
 		concurrency: concurrency,
 		quit:        make(chan bool),
+		done:        make(chan struct{}),
+		inflight:    make(map[string]*inflightJob),
 	}
 }
 
-// Start starts the worker
+// Start starts the worker and blocks until it is stopped
 func (w *Worker) Start() {
+	defer close(w.done)
+	
+	// Stopping cancels pops that are waiting for a job
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-w.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	
 	for i := 0; i < w.concurrency; i++ {
 		w.wg.Add(1)
-		go w.work()
+		go w.work(ctx)
 	}
 	w.wg.Wait()
 }
 
-// Stop stops the worker
+// Stop stops the worker after its current jobs finish
 func (w *Worker) Stop() {
-	close(w.quit)
-	w.wg.Wait()
+	w.StopContext(context.Background())
+}
+
+// StopContext stops the worker, waiting for current jobs until the context
+// is done. Jobs still running then are released back to the queue so
+// another worker can pick them up; their goroutines no longer acknowledge
+// or release them when they finish. It is safe to call more than once.
+func (w *Worker) StopContext(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.quit) })
+	
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+	}
+	
+	w.mutex.Lock()
+	running := make([]*inflightJob, 0, len(w.inflight))
+	for _, job := range w.inflight {
+		running = append(running, job)
+	}
+	w.mutex.Unlock()
+	
+	errs := []error{ctx.Err()}
+	for _, job := range running {
+		if err := job.abandon(w.queue); err != nil {
+			errs = append(errs, fmt.Errorf("release job %s: %w", job.popped.GetName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// abandon releases the popped job unless its goroutine already settled it
+func (j *inflightJob) abandon(queue Queue) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	
+	if j.settled || j.abandoned {
+		return nil
+	}
+	j.abandoned = true
+	return queue.Release(j.popped)
 }
 
-func (w *Worker) work() {
+func (w *Worker) work(ctx context.Context) {
 	defer w.wg.Done()
 	
 	for {
@@ -271,83 +837,560 @@ func (w *Worker) work() {
 		case <-w.quit:
 			return
 		default:
-			job, err := w.queue.Pop()
+			job, err := w.queue.PopCtx(ctx)
 			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
 				log.Printf("Error popping job: %v", err)
-				time.Sleep(1 * time.Second)
+				w.sleep(1 * time.Second)
 				continue
 			}
 			
 			if job == nil {
-				time.Sleep(100 * time.Millisecond)
+				// Blocking queues already waited for a job
+				if blocking, ok := w.queue.(interface{ blocking() bool }); !ok || !blocking.blocking() {
+					w.sleep(100 * time.Millisecond)
+				}
 				continue
 			}
 			
+			w.track(job, true)
+			stopHeartbeat := w.heartbeat(job)
 			w.processJob(job)
+			stopHeartbeat()
+			w.track(job, false)
 		}
 	}
 }
 
-func (w *Worker) processJob(job Job) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Job %s panicked: %v", job.GetName(), r)
+// sleep waits for the given duration unless the worker is stopped first
+func (w *Worker) sleep(d time.Duration) {
+	select {
+	case <-w.quit:
+	case <-time.After(d):
+	}
+}
+
+// heartbeat extends the job's reservation while it runs, on queues that
+// support it. The returned function stops it.
+func (w *Worker) heartbeat(job Job) func() {
+	extender, ok := w.queue.(Extender)
+	if !ok || extender.VisibilityTimeout() <= 0 {
+		return func() {}
+	}
+	
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(extender.VisibilityTimeout() / 3)
+		defer ticker.Stop()
+		
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := extender.ExtendCtx(context.Background(), job)
+				if errors.Is(err, ErrNotReserved) {
+					return // Acknowledged or released meanwhile
+				}
+				if err != nil {
+					log.Printf("Failed to extend reservation of job %s: %v", job.GetName(), err)
+				}
+			}
 		}
 	}()
 	
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+func (w *Worker) track(job Job, running bool) {
+	if !running {
+		w.mutex.Lock()
+		delete(w.inflight, job.GetID())
+		w.mutex.Unlock()
+		return
+	}
+	
+	popped := copyJob(job)
+	w.mutex.Lock()
+	w.inflight[job.GetID()] = &inflightJob{popped: popped}
+	w.mutex.Unlock()
+}
+
+// copyJob returns a copy of a popped job that shares no state with it
+func copyJob(job Job) Job {
+	raw, err := encodeJob(job)
+	if err != nil {
+		return job
+	}
+	copied, err := decodeJob(raw)
+	if err != nil {
+		return job
+	}
+	if bj, ok := job.(*BaseJob); ok {
+		copied.reservation = bj.reservation
+	}
+	return copied
+}
+
+// ack acknowledges a job. It reports false if StopContext released the job
+// while it ran, in which case the worker must not finish it.
+func (w *Worker) ack(job Job) bool {
+	return w.settle(job, func() {
+		if err := w.queue.Ack(job); err != nil {
+			log.Printf("Failed to acknowledge job %s: %v", job.GetName(), err)
+		}
+	})
+}
+
+// release hands a job back to the queue, like ack
+func (w *Worker) release(job Job, delay time.Duration) bool {
+	return w.settle(job, func() {
+		if err := w.queue.Release(job, delay); err != nil {
+			log.Printf("Failed to release job %s: %v", job.GetName(), err)
+		}
+	})
+}
+
+// settle runs the acknowledgement or release of a job unless StopContext
+// already released it
+func (w *Worker) settle(job Job, settle func()) bool {
+	w.mutex.Lock()
+	running := w.inflight[job.GetID()]
+	w.mutex.Unlock()
+	if running == nil {
+		settle()
+		return true
+	}
+	
+	running.mutex.Lock()
+	defer running.mutex.Unlock()
+	if running.abandoned {
+		return false
+	}
+	running.settled = true
+	settle()
+	return true
+}
+
+func (w *Worker) processJob(job Job) {
+	queueName, source := w.source(job)
+	
+	// Skip jobs whose batch was cancelled
+	if w.batchCancelled(job) {
+		if w.ack(job) {
+			w.manager.recordBatchJob(jobBatchID(job), nil)
+		}
+		return
+	}
+	
 	// Get handler for job
 	handler, exists := w.handlers[job.GetName()]
 	if !exists {
 		log.Printf("No handler found for job: %s", job.GetName())
+		w.fail(job, fmt.Errorf("no handler registered for job %s", job.GetName()))
 		return
 	}
 	
-	// Create job instance and set payload
+	// Create job instance and restore its state
 	jobInstance := handler()
-	jobInstance.SetPayload(job.GetPayload())
+	if err := hydrateJob(jobInstance, job); err != nil {
+		log.Printf("Job %s could not be hydrated: %v", job.GetName(), err)
+		w.fail(job, err)
+		return
+	}
+	
+	// Execute job through the middleware pipeline
+	w.emit(EventJobProcessing, job, queueName, 0, 0, nil)
+	started := time.Now()
+	err := w.run(jobInstance)
+	duration := time.Since(started)
+	
+	var release *ReleaseError
+	if errors.As(err, &release) {
+		w.metrics.record(job.GetName(), func(m *JobMetrics) { m.Released++ })
+		log.Printf("Job %s released for %s: %s", job.GetName(), release.Delay, release.Reason)
+		w.release(job, release.Delay)
+		return
+	}
+	
+	w.metrics.record(job.GetName(), func(m *JobMetrics) { m.Latency.observe(duration) })
 	
-	// Execute job
-	if err := jobInstance.Handle(); err != nil {
-		log.Printf("Job %s failed: %v", job.GetName(), err)
-		// TODO: Implement retry logic
-	} else {
+	if err == nil {
+		if !w.ack(job) {
+			log.Printf("Job %s finished after the worker released it", job.GetName())
+			return
+		}
 		log.Printf("Job %s completed successfully", job.GetName())
+		w.metrics.record(job.GetName(), func(m *JobMetrics) { m.Processed++ })
+		w.emit(EventJobProcessed, job, queueName, duration, 0, nil)
+		
+		if chainErr := w.manager.dispatchNextInChain(source, job); chainErr != nil {
+			log.Printf("Failed to dispatch next job in chain after %s: %v", job.GetName(), chainErr)
+		}
+		if batchID := jobBatchID(job); batchID != "" && w.manager != nil {
+			w.manager.recordBatchJob(batchID, nil)
+		}
+		return
+	}
+	
+	policy := w.retry
+	if retryable, ok := jobInstance.(RetryableJob); ok {
+		policy = retryable.RetryPolicy()
+	}
+	
+	attempts := job.GetAttempts() + 1
+	job.SetAttempts(attempts)
+	
+	if attempts < policy.MaxAttempts {
+		delay := policy.delay(attempts)
+		log.Printf("Job %s failed (attempt %d/%d), retrying in %s: %v", job.GetName(), attempts, policy.MaxAttempts, delay, err)
+		w.metrics.record(job.GetName(), func(m *JobMetrics) { m.Retried++ })
+		w.emit(EventJobRetrying, job, queueName, duration, delay, err)
+		w.release(job, delay)
+		return
+	}
+	
+	log.Printf("Job %s failed after %d attempt(s): %v", job.GetName(), attempts, err)
+	w.fail(job, err)
+}
+
+// batchCancelled reports whether the job belongs to a cancelled batch
+func (w *Worker) batchCancelled(job Job) bool {
+	batchID := jobBatchID(job)
+	if batchID == "" || w.manager == nil {
+		return false
+	}
+	
+	batch, err := w.manager.FindBatch(batchID)
+	return err == nil && batch.Cancelled()
+}
+
+// run executes the job and its middleware, turning a panic into an error
+func (w *Worker) run(job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job %s panicked: %v", job.GetName(), r)
+		}
+	}()
+	
+	middleware := w.middleware
+	if withMiddleware, ok := job.(JobWithMiddleware); ok {
+		middleware = append(append([]JobMiddleware{}, middleware...), withMiddleware.Middleware()...)
+	}
+	
+	return runPipeline(job, middleware, job.Handle)
+}
+
+// emit dispatches a job lifecycle event when the worker has a dispatcher
+func (w *Worker) emit(name string, job Job, queueName string, duration, delay time.Duration, err error) {
+	if w.events == nil {
+		return
+	}
+	w.events.Dispatch(newJobEvent(name, job, queueName, duration, delay, err))
+}
+
+// source returns the name and queue a popped job came from, which differs
+// from the worker's own queue when it consumes several queues
+func (w *Worker) source(job Job) (string, Queue) {
+	if pq, ok := w.queue.(*PriorityQueue); ok {
+		if origin, exists := pq.origin(job); exists {
+			return origin.name, origin.queue
+		}
+	}
+	return w.name, w.queue
+}
+
+// fail removes a job from the queue and records it as failed
+func (w *Worker) fail(job Job, reason error) {
+	queueName, _ := w.source(job)
+	if !w.ack(job) {
+		return
+	}
+	
+	if batchID := jobBatchID(job); batchID != "" && w.manager != nil {
+		w.manager.recordBatchJob(batchID, reason)
+	}
+	
+	w.metrics.record(job.GetName(), func(m *JobMetrics) { m.Failed++ })
+	// Emit once the failed job is stored so listeners can look it up
+	defer w.emit(EventJobFailed, job, queueName, 0, 0, reason)
+	
+	if w.failed == nil {
+		return
+	}
+	
+	raw, err := encodeJob(job)
+	if err != nil {
+		log.Printf("Failed to serialize failed job %s: %v", job.GetName(), err)
+	}
+	
+	failedJob := FailedJob{
+		ID:        job.GetID(),
+		Queue:     queueName,
+		Name:      job.GetName(),
+		Payload:   job.GetPayload(),
+		Job:       raw,
+		Attempts:  job.GetAttempts(),
+		Exception: reason.Error(),
+		FailedAt:  time.Now(),
+	}
+	
+	if err := w.failed.Log(failedJob); err != nil {
+		log.Printf("Failed to store failed job %s: %v", job.GetName(), err)
 	}
 }
 
-// MemoryQueue implements in-memory queue for testing
+// MemoryQueue implements in-memory queue for testing.
+// Jobs are stored serialized, exactly as a persistent backend would see them.
 type MemoryQueue struct {
-	jobs []Job
-	mutex sync.Mutex
+	jobs              [][]byte
+	delayed           delayedJobs
+	reserved          map[string]memoryReservation
+	visibilityTimeout time.Duration
+	mutex             sync.Mutex
+}
+
+type memoryReservation struct {
+	raw       []byte
+	expiresAt time.Time
+}
+
+// SetVisibilityTimeout sets how long a popped job stays reserved
+func (mq *MemoryQueue) SetVisibilityTimeout(timeout time.Duration) {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+	mq.visibilityTimeout = timeout
 }
 
 func (mq *MemoryQueue) Push(job Job, delay ...time.Duration) error {
+	return mq.PushCtx(context.Background(), job, delay...)
+}
+
+func (mq *MemoryQueue) PushCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	job.SetID(uuid.NewString())
+	raw, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	
 	mq.mutex.Lock()
 	defer mq.mutex.Unlock()
-	mq.jobs = append(mq.jobs, job)
+	mq.enqueue(raw, delay...)
 	return nil
 }
 
 func (mq *MemoryQueue) Pop() (Job, error) {
+	return mq.PopCtx(context.Background())
+}
+
+func (mq *MemoryQueue) PopCtx(ctx context.Context) (Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	
 	mq.mutex.Lock()
 	defer mq.mutex.Unlock()
+	mq.reapExpired()
+	mq.promoteDelayed()
 	if len(mq.jobs) == 0 {
 		return nil, nil
 	}
-	job := mq.jobs[0]
+	raw := mq.jobs[0]
 	mq.jobs = mq.jobs[1:]
+	
+	job, err := decodeJob(raw)
+	if err != nil {
+		return nil, err
+	}
+	
+	if mq.reserved == nil {
+		mq.reserved = make(map[string]memoryReservation)
+	}
+	mq.reserved[job.GetID()] = memoryReservation{raw: raw, expiresAt: time.Now().Add(mq.reservationTimeout())}
 	return job, nil
 }
 
+// VisibilityTimeout returns how long a popped job stays reserved
+func (mq *MemoryQueue) VisibilityTimeout() time.Duration {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+	return mq.reservationTimeout()
+}
+
+func (mq *MemoryQueue) reservationTimeout() time.Duration {
+	if mq.visibilityTimeout == 0 {
+		return DefaultVisibilityTimeout
+	}
+	return mq.visibilityTimeout
+}
+
+// Ack removes a processed job from the reserved set
+func (mq *MemoryQueue) Ack(job Job) error {
+	return mq.AckCtx(context.Background(), job)
+}
+
+func (mq *MemoryQueue) AckCtx(ctx context.Context, job Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+	delete(mq.reserved, job.GetID())
+	return nil
+}
+
+// Release returns a reserved job to the queue
+func (mq *MemoryQueue) Release(job Job, delay ...time.Duration) error {
+	return mq.ReleaseCtx(context.Background(), job, delay...)
+}
+
+func (mq *MemoryQueue) ReleaseCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	raw, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+	
+	// A job whose reservation expired was already put back by the reaper
+	if _, reserved := mq.reserved[job.GetID()]; !reserved {
+		return nil
+	}
+	delete(mq.reserved, job.GetID())
+	mq.enqueue(raw, delay...)
+	return nil
+}
+
+// Extend pushes the deadline of a job's reservation a visibility timeout
+// into the future
+func (mq *MemoryQueue) Extend(job Job) error {
+	return mq.ExtendCtx(context.Background(), job)
+}
+
+func (mq *MemoryQueue) ExtendCtx(ctx context.Context, job Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+	
+	reservation, reserved := mq.reserved[job.GetID()]
+	if !reserved {
+		return fmt.Errorf("%w: %s", ErrNotReserved, job.GetID())
+	}
+	reservation.expiresAt = time.Now().Add(mq.reservationTimeout())
+	mq.reserved[job.GetID()] = reservation
+	return nil
+}
+
+func (mq *MemoryQueue) enqueue(raw []byte, delay ...time.Duration) {
+	if len(delay) > 0 && delay[0] > 0 {
+		heap.Push(&mq.delayed, delayedJob{raw: raw, availableAt: time.Now().Add(delay[0])})
+		return
+	}
+	mq.jobs = append(mq.jobs, raw)
+}
+
+// promoteDelayed moves due delayed jobs onto the queue in time order
+func (mq *MemoryQueue) promoteDelayed() {
+	now := time.Now()
+	for len(mq.delayed) > 0 && !mq.delayed[0].availableAt.After(now) {
+		job := heap.Pop(&mq.delayed).(delayedJob)
+		mq.jobs = append(mq.jobs, job.raw)
+	}
+}
+
+// ReapExpired re-queues jobs whose visibility timeout has passed. Pop does
+// this too, before reserving the next job.
+func (mq *MemoryQueue) ReapExpired() (int64, error) {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+	return mq.reapExpired(), nil
+}
+
+// reapExpired puts jobs whose reservation expired back at the head of the queue
+func (mq *MemoryQueue) reapExpired() int64 {
+	var reaped int64
+	now := time.Now()
+	for id, reservation := range mq.reserved {
+		if now.After(reservation.expiresAt) {
+			mq.jobs = append([][]byte{reservation.raw}, mq.jobs...)
+			delete(mq.reserved, id)
+			reaped++
+		}
+	}
+	return reaped
+}
+
 func (mq *MemoryQueue) Size() (int64, error) {
+	return mq.SizeCtx(context.Background())
+}
+
+func (mq *MemoryQueue) SizeCtx(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	
 	mq.mutex.Lock()
 	defer mq.mutex.Unlock()
 	return int64(len(mq.jobs)), nil
 }
 
 func (mq *MemoryQueue) Clear() error {
+	return mq.ClearCtx(context.Background())
+}
+
+func (mq *MemoryQueue) ClearCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
 	mq.mutex.Lock()
 	defer mq.mutex.Unlock()
 	mq.jobs = nil
+	mq.delayed = nil
+	mq.reserved = nil
 	return nil
-}
\ No newline at end of file
+}
+
+type delayedJob struct {
+	raw         []byte
+	availableAt time.Time
+}
+
+// delayedJobs is a min-heap of delayed jobs ordered by availability
+type delayedJobs []delayedJob
+
+func (d delayedJobs) Len() int           { return len(d) }
+func (d delayedJobs) Less(i, j int) bool { return d[i].availableAt.Before(d[j].availableAt) }
+func (d delayedJobs) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+func (d *delayedJobs) Push(x interface{}) {
+	*d = append(*d, x.(delayedJob))
+}
+
+func (d *delayedJobs) Pop() interface{} {
+	old := *d
+	n := len(old)
+	item := old[n-1]
+	*d = old[:n-1]
+	return item
+}
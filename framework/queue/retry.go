@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes how long to wait before a failed job is attempted again
+type Backoff interface {
+	Delay(attempt int) time.Duration
+}
+
+// FixedBackoff waits the same interval before every retry
+type FixedBackoff struct {
+	Interval time.Duration
+}
+
+func (b FixedBackoff) Delay(attempt int) time.Duration {
+	return b.Interval
+}
+
+// ExponentialBackoff doubles the delay on every attempt, capped at Max.
+// Jitter is the fraction (0-1) of the delay that is randomised to avoid
+// retries of many jobs landing at the same moment.
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter float64
+}
+
+func (b ExponentialBackoff) Delay(attempt int) time.Duration {
+	delay := b.Base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay <= 0 || (b.Max > 0 && delay >= b.Max) {
+			delay = b.Max
+			break
+		}
+	}
+
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+
+	if b.Jitter > 0 && delay > 0 {
+		spread := float64(delay) * b.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+
+	return delay
+}
+
+// RetryPolicy controls how often a failing job is attempted
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     Backoff
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		Backoff: ExponentialBackoff{
+			Base:   time.Second,
+			Max:    time.Minute,
+			Jitter: 0.2,
+		},
+	}
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	if p.Backoff == nil {
+		return 0
+	}
+	return p.Backoff.Delay(attempt)
+}
+
+// RetryableJob is implemented by jobs that override the worker's retry policy
+type RetryableJob interface {
+	RetryPolicy() RetryPolicy
+}
@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SyncQueue runs jobs inline when they are pushed, using the handlers
+// registered on its QueueManager, so tests and CLI commands can dispatch
+// jobs without starting workers. A job's error is returned from Push; it
+// is not retried or stored as failed. Delays are ignored.
+type SyncQueue struct {
+	manager   *QueueManager
+	queueName string
+}
+
+// NewSyncQueue creates a sync queue that runs jobs with the manager's
+// handlers and middleware
+func NewSyncQueue(manager *QueueManager, queueName string) *SyncQueue {
+	return &SyncQueue{manager: manager, queueName: queueName}
+}
+
+func (sq *SyncQueue) Push(job Job, delay ...time.Duration) error {
+	return sq.PushCtx(context.Background(), job, delay...)
+}
+
+// PushCtx runs the job before returning. The job goes through the same
+// serialization as a queued job, so it sees exactly what a worker would.
+func (sq *SyncQueue) PushCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	job.SetID(uuid.NewString())
+	raw, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	queued, err := decodeJob(raw)
+	if err != nil {
+		return err
+	}
+
+	return sq.run(queued)
+}
+
+func (sq *SyncQueue) run(job *BaseJob) error {
+	qm := sq.manager
+	qm.mutex.RLock()
+	handler, exists := qm.handlers[job.GetName()]
+	worker := &Worker{
+		name:       sq.queueName,
+		manager:    qm,
+		queue:      sq,
+		middleware: qm.middleware,
+		events:     qm.events,
+		metrics:    qm.metrics,
+	}
+	qm.mutex.RUnlock()
+
+	if worker.batchCancelled(job) {
+		qm.recordBatchJob(job.batchID, nil)
+		return nil
+	}
+
+	if !exists {
+		return sq.fail(worker, job, fmt.Errorf("no handler registered for job %s", job.GetName()))
+	}
+
+	instance := handler()
+	if err := hydrateJob(instance, job); err != nil {
+		return sq.fail(worker, job, err)
+	}
+
+	worker.emit(EventJobProcessing, job, sq.queueName, 0, 0, nil)
+	started := time.Now()
+	err := worker.run(instance)
+	duration := time.Since(started)
+	worker.metrics.record(job.GetName(), func(m *JobMetrics) { m.Latency.observe(duration) })
+
+	// There is no queue to release onto, so a release is reported as an error
+	var release *ReleaseError
+	if errors.As(err, &release) {
+		err = fmt.Errorf("job %s released on a sync queue: %w", job.GetName(), err)
+	}
+	if err != nil {
+		job.SetAttempts(job.GetAttempts() + 1)
+		return sq.fail(worker, job, err)
+	}
+
+	worker.metrics.record(job.GetName(), func(m *JobMetrics) { m.Processed++ })
+	worker.emit(EventJobProcessed, job, sq.queueName, duration, 0, nil)
+
+	if job.batchID != "" {
+		qm.recordBatchJob(job.batchID, nil)
+	}
+	return qm.dispatchNextInChain(sq, job)
+}
+
+// fail reports a failed job and returns its error to the caller
+func (sq *SyncQueue) fail(worker *Worker, job *BaseJob, reason error) error {
+	if job.batchID != "" {
+		sq.manager.recordBatchJob(job.batchID, reason)
+	}
+	worker.metrics.record(job.GetName(), func(m *JobMetrics) { m.Failed++ })
+	worker.emit(EventJobFailed, job, sq.queueName, 0, 0, reason)
+	return reason
+}
+
+// Pop always returns no job; pushed jobs have already run
+func (sq *SyncQueue) Pop() (Job, error) {
+	return nil, nil
+}
+
+func (sq *SyncQueue) PopCtx(ctx context.Context) (Job, error) {
+	return nil, ctx.Err()
+}
+
+func (sq *SyncQueue) Ack(job Job) error {
+	return nil
+}
+
+func (sq *SyncQueue) AckCtx(ctx context.Context, job Job) error {
+	return nil
+}
+
+func (sq *SyncQueue) Release(job Job, delay ...time.Duration) error {
+	return nil
+}
+
+func (sq *SyncQueue) ReleaseCtx(ctx context.Context, job Job, delay ...time.Duration) error {
+	return nil
+}
+
+func (sq *SyncQueue) Size() (int64, error) {
+	return 0, nil
+}
+
+func (sq *SyncQueue) SizeCtx(ctx context.Context) (int64, error) {
+	return 0, ctx.Err()
+}
+
+func (sq *SyncQueue) Clear() error {
+	return nil
+}
+
+func (sq *SyncQueue) ClearCtx(ctx context.Context) error {
+	return ctx.Err()
+}
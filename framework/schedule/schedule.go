@@ -0,0 +1,413 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/test/myapp/framework/cache"
+	"github.com/test/myapp/framework/queue"
+)
+
+// Schedule holds the application's periodic tasks
+type Schedule struct {
+	events   []*Event
+	queue    *queue.QueueManager
+	locks    cache.Cache
+	location *time.Location
+	mutex    sync.RWMutex
+	running  sync.WaitGroup
+}
+
+// New creates a schedule that dispatches scheduled jobs to the given queue
+// manager. Locks are kept in memory until SetLockStore is called.
+func New(qm *queue.QueueManager) *Schedule {
+	return &Schedule{
+		queue:    qm,
+		location: time.Local,
+	}
+}
+
+// SetLockStore sets the cache used for overlap and single-server locks.
+// Use a shared store such as Redis when several servers run the schedule.
+func (s *Schedule) SetLockStore(store cache.Cache) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.locks = store
+}
+
+// SetTimezone sets the default timezone events are evaluated in
+func (s *Schedule) SetTimezone(location *time.Location) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.location = location
+}
+
+// Call schedules a function
+func (s *Schedule) Call(name string, task func() error) *Event {
+	return s.add(&Event{
+		name: name,
+		task: task,
+	})
+}
+
+// Job schedules dispatching a job onto a queue
+func (s *Schedule) Job(job queue.Job, queueName ...string) *Event {
+	return s.add(&Event{
+		name: job.GetName(),
+		task: func() error {
+			if s.queue == nil {
+				return fmt.Errorf("no queue manager to dispatch %s", job.GetName())
+			}
+			return s.queue.Dispatch(job, queueName...)
+		},
+	})
+}
+
+func (s *Schedule) add(event *Event) *Event {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	event.schedule = s
+	s.events = append(s.events, event)
+	return event
+}
+
+// Events returns all scheduled events
+func (s *Schedule) Events() []*Event {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]*Event(nil), s.events...)
+}
+
+// DueEvents returns the events due at the minute of now
+func (s *Schedule) DueEvents(now time.Time) []*Event {
+	var due []*Event
+	for _, event := range s.Events() {
+		if event.IsDue(now) {
+			due = append(due, event)
+		}
+	}
+	return due
+}
+
+// RunDue runs every event due at the minute of now and waits for them
+func (s *Schedule) RunDue(now time.Time) error {
+	// Collect invalid events before any goroutine appends to errs
+	var errs []error
+	var due []*Event
+	for _, event := range s.Events() {
+		if event.err != nil {
+			errs = append(errs, fmt.Errorf("scheduled task %s: %w", event.name, event.err))
+		} else if event.IsDue(now) {
+			due = append(due, event)
+		}
+	}
+
+	var errMutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, event := range due {
+		wg.Add(1)
+		go func(event *Event) {
+			defer wg.Done()
+			if err := event.run(now); err != nil {
+				errMutex.Lock()
+				errs = append(errs, fmt.Errorf("scheduled task %s: %w", event.name, err))
+				errMutex.Unlock()
+			}
+		}(event)
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Run runs due events at the start of every minute until the context is
+// done, then waits for running events to finish
+func (s *Schedule) Run(ctx context.Context) error {
+	log.Printf("⏰ Scheduler started with %d task(s)", len(s.Events()))
+
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+
+		select {
+		case <-ctx.Done():
+			s.running.Wait()
+			return nil
+		case <-time.After(next.Sub(now)):
+		}
+
+		s.running.Add(1)
+		go func(at time.Time) {
+			defer s.running.Done()
+			if err := s.RunDue(at); err != nil {
+				log.Printf("Scheduled tasks failed: %v", err)
+			}
+		}(next)
+	}
+}
+
+func (s *Schedule) lockStore() cache.Cache {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.locks == nil {
+		s.locks = cache.NewMemoryCache("schedule")
+	}
+	return s.locks
+}
+
+func (s *Schedule) defaultLocation() *time.Location {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.location
+}
+
+// Event is a task on the schedule, configured with the fluent methods
+type Event struct {
+	schedule            *Schedule
+	name                string
+	description         string
+	task                func() error
+	cron                *CronExpression
+	location            *time.Location
+	withoutOverlapping  bool
+	overlapExpiresAfter time.Duration
+	onOneServer         bool
+	err                 error
+}
+
+// Name sets the name used in listings and lock keys
+func (e *Event) Name(name string) *Event {
+	e.name = name
+	return e
+}
+
+// Description sets a human readable description
+func (e *Event) Description(description string) *Event {
+	e.description = description
+	return e
+}
+
+// Cron sets a custom cron expression
+func (e *Event) Cron(expr string) *Event {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		e.err = err
+		return e
+	}
+	e.cron = cron
+	return e
+}
+
+// EveryMinute runs the event every minute
+func (e *Event) EveryMinute() *Event {
+	return e.Cron("* * * * *")
+}
+
+// EveryFiveMinutes runs the event every five minutes
+func (e *Event) EveryFiveMinutes() *Event {
+	return e.Cron("*/5 * * * *")
+}
+
+// EveryTenMinutes runs the event every ten minutes
+func (e *Event) EveryTenMinutes() *Event {
+	return e.Cron("*/10 * * * *")
+}
+
+// EveryFifteenMinutes runs the event every fifteen minutes
+func (e *Event) EveryFifteenMinutes() *Event {
+	return e.Cron("*/15 * * * *")
+}
+
+// EveryThirtyMinutes runs the event every thirty minutes
+func (e *Event) EveryThirtyMinutes() *Event {
+	return e.Cron("0,30 * * * *")
+}
+
+// Hourly runs the event at the start of every hour
+func (e *Event) Hourly() *Event {
+	return e.Cron("0 * * * *")
+}
+
+// HourlyAt runs the event every hour at the given minute
+func (e *Event) HourlyAt(minute int) *Event {
+	return e.Cron(fmt.Sprintf("%d * * * *", minute))
+}
+
+// Daily runs the event every day at midnight
+func (e *Event) Daily() *Event {
+	return e.Cron("0 0 * * *")
+}
+
+// DailyAt runs the event every day at the given "HH:MM" time
+func (e *Event) DailyAt(at string) *Event {
+	hour, minute, err := parseClock(at)
+	if err != nil {
+		e.err = err
+		return e
+	}
+	return e.Cron(fmt.Sprintf("%d %d * * *", minute, hour))
+}
+
+// Weekly runs the event every Sunday at midnight
+func (e *Event) Weekly() *Event {
+	return e.Cron("0 0 * * 0")
+}
+
+// WeeklyOn runs the event every week on the given day and "HH:MM" time
+func (e *Event) WeeklyOn(day time.Weekday, at string) *Event {
+	hour, minute, err := parseClock(at)
+	if err != nil {
+		e.err = err
+		return e
+	}
+	return e.Cron(fmt.Sprintf("%d %d * * %d", minute, hour, day))
+}
+
+// Monthly runs the event on the first day of every month at midnight
+func (e *Event) Monthly() *Event {
+	return e.Cron("0 0 1 * *")
+}
+
+// MonthlyOn runs the event every month on the given day and "HH:MM" time
+func (e *Event) MonthlyOn(day int, at string) *Event {
+	hour, minute, err := parseClock(at)
+	if err != nil {
+		e.err = err
+		return e
+	}
+	return e.Cron(fmt.Sprintf("%d %d %d * *", minute, hour, day))
+}
+
+// Timezone evaluates the event's times in the named IANA timezone
+func (e *Event) Timezone(name string) *Event {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		e.err = err
+		return e
+	}
+	e.location = location
+	return e
+}
+
+// WithoutOverlapping skips a run while the previous one is still going.
+// The lock expires after 24 hours, or the given duration, in case the
+// process dies while holding it.
+func (e *Event) WithoutOverlapping(expiresAfter ...time.Duration) *Event {
+	e.withoutOverlapping = true
+	e.overlapExpiresAfter = 24 * time.Hour
+	if len(expiresAfter) > 0 {
+		e.overlapExpiresAfter = expiresAfter[0]
+	}
+	return e
+}
+
+// OnOneServer runs the event on only one server per due minute. The
+// schedule's lock store must be shared between the servers.
+func (e *Event) OnOneServer() *Event {
+	e.onOneServer = true
+	return e
+}
+
+// GetName returns the event name
+func (e *Event) GetName() string {
+	return e.name
+}
+
+// GetDescription returns the event description
+func (e *Event) GetDescription() string {
+	return e.description
+}
+
+// Expression returns the event's cron expression
+func (e *Event) Expression() string {
+	if e.cron == nil {
+		return ""
+	}
+	return e.cron.String()
+}
+
+// Err returns the first configuration error, such as an invalid cron
+// expression or timezone
+func (e *Event) Err() error {
+	if e.err == nil && e.cron == nil {
+		return fmt.Errorf("no frequency set")
+	}
+	return e.err
+}
+
+// Location returns the timezone the event is evaluated in
+func (e *Event) Location() *time.Location {
+	if e.location != nil {
+		return e.location
+	}
+	if e.schedule != nil {
+		return e.schedule.defaultLocation()
+	}
+	return time.Local
+}
+
+// IsDue reports whether the event should run at the minute of now
+func (e *Event) IsDue(now time.Time) bool {
+	if e.err != nil || e.cron == nil {
+		return false
+	}
+	return e.cron.Matches(now.In(e.Location()))
+}
+
+// NextRun returns when the event will next be due after now
+func (e *Event) NextRun(now time.Time) time.Time {
+	if e.err != nil || e.cron == nil {
+		return time.Time{}
+	}
+	return e.cron.Next(now.In(e.Location()))
+}
+
+// run executes the event, taking its locks first
+func (e *Event) run(now time.Time) error {
+	locks := e.schedule.lockStore()
+
+	if e.onOneServer {
+		key := fmt.Sprintf("schedule:%s:%s", e.name, now.UTC().Format("200601021504"))
+		acquired, err := locks.Add(key, true, time.Hour)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			return nil
+		}
+	}
+
+	if e.withoutOverlapping {
+		lock := locks.Lock("schedule:"+e.name+":overlap", e.overlapExpiresAfter)
+		acquired, err := lock.Get()
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			log.Printf("Skipping scheduled task %s: previous run still in progress", e.name)
+			return nil
+		}
+		defer lock.Release()
+	}
+
+	log.Printf("⏰ Running scheduled task %s", e.name)
+	return e.task()
+}
+
+// parseClock parses an "HH:MM" time of day
+func parseClock(at string) (int, int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(at, "%d:%d", &hour, &minute); err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", at)
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", at)
+	}
+	return hour, minute, nil
+}
@@ -0,0 +1,282 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/test/myapp/config"
+	"github.com/test/myapp/framework/cache"
+	"github.com/test/myapp/framework/database"
+	"github.com/test/myapp/framework/queue"
+	"github.com/test/myapp/internal/constants"
+	"gorm.io/gorm"
+)
+
+// redisPingTimeout bounds the startup check of each Redis connection
+const redisPingTimeout = 5 * time.Second
+
+// redisConnection is a Redis client and where it points, for errors
+type redisConnection struct {
+	client *redis.Client
+	addr   string
+}
+
+// Redis returns the client for a named Redis connection, "default" when no
+// name is given. Clients are created on first use and shared.
+func (g *Golara) Redis(name ...string) (*redis.Client, error) {
+	connName := "default"
+	if len(name) > 0 {
+		connName = name[0]
+	}
+
+	conn, ok := g.redisConfig.Connections[connName]
+	if !ok {
+		return nil, fmt.Errorf("redis connection %q is not configured", connName)
+	}
+	return g.redisClient(connName, conn), nil
+}
+
+func (g *Golara) redisClient(key string, conn config.RedisConnection) *redis.Client {
+	g.redisMutex.Lock()
+	defer g.redisMutex.Unlock()
+
+	if existing, ok := g.redis[key]; ok {
+		return existing.client
+	}
+
+	addr := conn.Host + ":" + conn.Port
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: conn.Password,
+		DB:       conn.Database,
+	})
+	g.redis[key] = redisConnection{client: client, addr: addr}
+	return client
+}
+
+// redisFor returns the client for a named connection, or for the inline
+// settings when the name is empty
+func (g *Golara) redisFor(connection string, inline config.RedisConnection) (*redis.Client, error) {
+	if connection != "" {
+		return g.Redis(connection)
+	}
+	key := fmt.Sprintf("%s:%s/%d", inline.Host, inline.Port, inline.Database)
+	return g.redisClient(key, inline), nil
+}
+
+// pingRedis checks every Redis connection in use
+func (g *Golara) pingRedis() error {
+	g.redisMutex.Lock()
+	defer g.redisMutex.Unlock()
+
+	for name, conn := range g.redis {
+		ctx, cancel := context.WithTimeout(context.Background(), redisPingTimeout)
+		err := conn.client.Ping(ctx).Err()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("redis connection %s at %s is unreachable: %w", name, conn.addr, err)
+		}
+	}
+	return nil
+}
+
+func (g *Golara) closeRedis() error {
+	g.redisMutex.Lock()
+	defer g.redisMutex.Unlock()
+
+	var errs []error
+	for name, conn := range g.redis {
+		if err := conn.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("redis connection %s: %w", name, err))
+		}
+	}
+	g.redis = make(map[string]redisConnection)
+	return errors.Join(errs...)
+}
+
+// setupCache builds every configured cache store
+func (g *Golara) setupCache(cfg *config.CacheConfig) error {
+	for _, name := range sortedKeys(cfg.Stores) {
+		store, err := g.buildCacheStore(cfg.Stores[name])
+		if err != nil {
+			return fmt.Errorf("cache store %s: %w", name, err)
+		}
+		g.Cache.AddStore(name, store)
+	}
+
+	if _, ok := cfg.Stores[cfg.Default]; !ok {
+		return fmt.Errorf("default cache store %q is not configured", cfg.Default)
+	}
+	g.Cache.SetDefault(cfg.Default)
+	return nil
+}
+
+func (g *Golara) buildCacheStore(store config.CacheStore) (cache.Cache, error) {
+	limits := cache.MemoryCacheConfig{
+		MaxEntries: store.MaxEntries,
+		MaxBytes:   store.MaxBytes,
+	}
+
+	switch store.Driver {
+	case constants.CacheDriverMemory:
+		return cache.NewMemoryCacheWithConfig(store.Prefix, limits), nil
+	case constants.CacheDriverRedis, constants.CacheDriverTiered:
+		client, err := g.redisFor(store.Connection, config.RedisConnection{
+			Host:     store.Host,
+			Port:     store.Port,
+			Password: store.Password,
+			Database: store.Database,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		remote := cache.NewRedisCacheWithClient(client, store.Prefix)
+		if store.Driver == constants.CacheDriverRedis {
+			return remote, nil
+		}
+		return cache.NewTieredCache(
+			cache.NewMemoryCacheWithConfig(store.Prefix, limits),
+			remote,
+			cache.TieredCacheConfig{Channel: store.Prefix + ":cache:invalidate"},
+		), nil
+	default:
+		return nil, fmt.Errorf("unsupported cache driver %q", store.Driver)
+	}
+}
+
+// setupQueue builds every configured queue connection. Each is registered
+// under its connection name, and the default one also under its queue name,
+// which becomes the default queue.
+func (g *Golara) setupQueue(cfg *config.QueueConfig) error {
+	for _, name := range sortedKeys(cfg.Connections) {
+		conn := cfg.Connections[name]
+		q, client, err := g.buildQueue(conn)
+		if err != nil {
+			return fmt.Errorf("queue connection %s: %w", name, err)
+		}
+		g.Queue.AddQueue(name, q)
+
+		if name != cfg.Default {
+			continue
+		}
+		queueName := conn.Queue
+		if queueName == "" {
+			queueName = constants.DefaultQueueName
+		}
+		g.Queue.AddQueue(queueName, q)
+		g.Queue.SetDefault(queueName)
+
+		// Failed jobs and batches live next to the default queue
+		if client != nil {
+			g.Queue.SetFailedJobStore(queue.NewRedisFailedJobStore(client, constants.DefaultCachePrefix+":failed_jobs"))
+			g.Queue.SetBatchRepository(queue.NewRedisBatchRepository(client, constants.DefaultCachePrefix+":batches"))
+		}
+	}
+
+	if _, ok := cfg.Connections[cfg.Default]; !ok {
+		return fmt.Errorf("default queue connection %q is not configured", cfg.Default)
+	}
+	return nil
+}
+
+func (g *Golara) buildQueue(conn config.QueueConnection) (queue.Queue, *redis.Client, error) {
+	queueName := conn.Queue
+	if queueName == "" {
+		queueName = constants.DefaultQueueName
+	}
+
+	switch conn.Driver {
+	case constants.QueueDriverMemory:
+		return &queue.MemoryQueue{}, nil, nil
+	case constants.QueueDriverSync:
+		return queue.NewSyncQueue(g.Queue, queueName), nil, nil
+	case constants.QueueDriverDatabase:
+		// Databases are connected after New, so resolve the connection on use
+		return queue.NewLazyDatabaseQueue(g.databaseConnection(conn.Connection), queueName), nil, nil
+	case constants.QueueDriverRedis:
+		client, err := g.redisFor(conn.Connection, config.RedisConnection{
+			Host:     conn.Host,
+			Port:     conn.Port,
+			Password: conn.Password,
+			Database: conn.Database,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return queue.NewRedisQueue(client, queueName), client, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported queue driver %q", conn.Driver)
+	}
+}
+
+// registerDatabases registers the configured database connections without
+// opening them
+func (g *Golara) registerDatabases() error {
+	var errs []error
+	for _, name := range sortedKeys(g.databaseConfig.Connections) {
+		conn := g.databaseConfig.Connections[name]
+		if err := g.DB.Register(name, databaseConfigFor(conn)); err != nil {
+			errs = append(errs, fmt.Errorf("database connection %s: %w", name, err))
+		}
+	}
+	if _, ok := g.databaseConfig.Connections[g.databaseConfig.Default]; ok {
+		g.DB.SetDefault(g.databaseConfig.Default)
+	}
+	return errors.Join(errs...)
+}
+
+// databaseConfigFor converts a configured connection for the DatabaseManager
+func databaseConfigFor(conn config.DatabaseConnection) database.DatabaseConfig {
+	return database.DatabaseConfig{
+		Driver:                 conn.Driver,
+		Host:                   conn.Host,
+		Port:                   conn.Port,
+		Database:               conn.Database,
+		Username:               conn.Username,
+		Password:               conn.Password,
+		Charset:                conn.Charset,
+		Timezone:               conn.Timezone,
+		Options:                conn.Options,
+		SSLMode:                conn.SSLMode,
+		SSLRootCert:            conn.SSLRootCert,
+		SSLCert:                conn.SSLCert,
+		SSLKey:                 conn.SSLKey,
+		MaxIdleConns:           conn.MaxIdleConns,
+		MaxOpenConns:           conn.MaxOpenConns,
+		ConnMaxLifetime:        conn.ConnMaxLifetime,
+		ConnMaxIdleTime:        conn.ConnMaxIdleTime,
+		LogLevel:               conn.LogLevel,
+		SlowThreshold:          conn.SlowThreshold,
+		LogFile:                conn.LogFile,
+		PrepareStmt:            conn.PrepareStmt,
+		SkipDefaultTransaction: conn.SkipDefaultTransaction,
+		Read:                   conn.Read,
+		Write:                  conn.Write,
+		Sticky:                 conn.Sticky,
+	}
+}
+
+// databaseConnection returns a resolver for a named database connection,
+// or the default one when the name is empty
+func (g *Golara) databaseConnection(name string) func() (*gorm.DB, error) {
+	return func() (*gorm.DB, error) {
+		if name == "" {
+			return g.DB.Connection()
+		}
+		return g.DB.Connection(name)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
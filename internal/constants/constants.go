@@ -19,9 +19,11 @@ const (
 	// Cache drivers
 	CacheDriverMemory = "memory"
 	CacheDriverRedis  = "redis"
+	CacheDriverTiered = "tiered"
 	
 	// Queue drivers
-	QueueDriverSync   = "sync"
-	QueueDriverRedis  = "redis"
-	QueueDriverMemory = "memory"
+	QueueDriverSync     = "sync"
+	QueueDriverRedis    = "redis"
+	QueueDriverMemory   = "memory"
+	QueueDriverDatabase = "database"
 )
\ No newline at end of file
@@ -1,8 +1,12 @@
 package routes
 
 import (
+	"strings"
+
 	"github.com/test/myapp/app/controllers"
+	"github.com/test/myapp/config"
 	"github.com/test/myapp/framework"
+	"github.com/test/myapp/framework/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -22,6 +26,14 @@ func RegisterAPIRoutes(app *framework.Golara) {
 	api.Get("/users", userController.Index)
 	api.Post("/users", userController.Store)
 
+	// Queue sizes, job metrics and database health. Opt-in: only
+	// registered when MONITORING_API_KEYS lists keys that may read them.
+	if keys := monitoringKeys(); len(keys) > 0 {
+		requireKey := middleware.APIKeyAuth(keys)
+		api.Get("/queue/status", requireKey, app.QueueStatusHandler())
+		api.Get("/health/database", requireKey, app.DatabaseHealthHandler())
+	}
+
 	// Health check
 	api.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
@@ -31,3 +43,14 @@ func RegisterAPIRoutes(app *framework.Golara) {
 		})
 	})
 }
+
+// monitoringKeys returns the API keys allowed to read the monitoring routes
+func monitoringKeys() []string {
+	var keys []string
+	for _, key := range config.GetEnvSlice("MONITORING_API_KEYS", nil, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,18 @@
+package routes
+
+import "github.com/test/myapp/framework"
+
+// RegisterSchedule registers the application's scheduled tasks.
+// Run them with: go run main.go -subcommand schedule:work
+func RegisterSchedule(app *framework.Golara) {
+	// Examples:
+	//
+	// app.Schedule.Job(jobs.NewSendEmailJob("team@example.com", "Daily report", "...")).
+	// 	DailyAt("08:00").
+	// 	Timezone("Europe/London").
+	// 	OnOneServer()
+	//
+	// app.Schedule.Call("cleanup", func() error {
+	// 	return app.Cache.Store().Flush()
+	// }).EveryFiveMinutes().WithoutOverlapping()
+}